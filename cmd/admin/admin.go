@@ -0,0 +1,159 @@
+package main
+
+import (
+	"auth-strategies/internal/auth"
+	"auth-strategies/internal/config"
+	"auth-strategies/internal/db"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: admin <command> [arguments]
+
+commands:
+  keys add [-alg EdDSA|ES256|RS256] [-activate-in 10m]   add a token signing key, activating it after a delay
+  keys list                                              list token signing keys and their state
+  keys retire -kid <kid>                                 stop signing with a key, tokens it signed stay valid
+  keys revoke -kid <kid>                                 delete a key, invalidating every token it signed
+  keys prune                                             delete keys that no longer verify any unexpired token
+  unlock -email <email> | -ip <ip>                       lift the lockout after failed logins of an email or IP address
+`
+
+func main() {
+	config.SetupLogger(config.LogLevelInfo)
+
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.ParseConfig()
+	ctx := context.Background()
+
+	pool, err := db.Connect(ctx, &cfg.Db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("database connection failed")
+	}
+	defer pool.Close()
+
+	authService, err := auth.NewService(ctx, pool, &cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("auth service initialization failed")
+	}
+
+	switch os.Args[1] {
+	case "keys":
+		err = keys(ctx, authService, os.Args[2], os.Args[3:])
+	case "unlock":
+		err = unlock(ctx, authService, os.Args[2:])
+	default:
+		err = fmt.Errorf("unknown command %q", os.Args[1])
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("command failed")
+	}
+}
+
+func keys(ctx context.Context, s *auth.Service, command string, args []string) error {
+	fs := flag.NewFlagSet("keys "+command, flag.ExitOnError)
+	switch command {
+	case "add":
+		// Comfortably longer than the key refresh interval of the servers plus the cache lifetime of the JWKS endpoint
+		alg := fs.String("alg", "EdDSA", "signing algorithm: EdDSA, ES256 or RS256")
+		activateIn := fs.Duration("activate-in", 10*time.Minute, "delay before the key starts signing tokens")
+		fs.Parse(args)
+
+		kid, err := s.AddSigningKey(ctx, *alg, *activateIn)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("added key %s, signing from %s\n", kid, time.Now().Add(*activateIn).Format(time.RFC3339))
+		return nil
+
+	case "list":
+		fs.Parse(args)
+
+		infos, err := s.ListSigningKeys(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KID\tALG\tSTATUS\tACTIVATES AT\tSIGNS UNTIL\tVERIFIABLE UNTIL")
+		for _, info := range infos {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Kid, info.Algorithm, info.Status,
+				info.ActivatesAt.Format(time.RFC3339), formatOptionalTime(info.SignsUntil),
+				formatOptionalTime(info.VerifiableUntil))
+		}
+		return tw.Flush()
+
+	case "retire", "revoke":
+		kid := fs.String("kid", "", "id of the key")
+		fs.Parse(args)
+		if *kid == "" {
+			return errors.New("-kid is required")
+		}
+
+		var err error
+		if command == "retire" {
+			err = s.RetireSigningKey(ctx, *kid)
+		} else {
+			err = s.RevokeSigningKey(ctx, *kid)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%sd key %s\n", command, *kid)
+		return nil
+
+	case "prune":
+		fs.Parse(args)
+
+		pruned, err := s.PruneSigningKeys(ctx)
+		if err != nil {
+			return err
+		}
+		for _, kid := range pruned {
+			fmt.Printf("pruned key %s\n", kid)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown keys command %q", command)
+}
+
+func unlock(ctx context.Context, s *auth.Service, args []string) error {
+	fs := flag.NewFlagSet("unlock", flag.ExitOnError)
+	email := fs.String("email", "", "email address to unlock")
+	ip := fs.String("ip", "", "IP address to unlock")
+	fs.Parse(args)
+	if (*email == "") == (*ip == "") {
+		return errors.New("exactly one of -email and -ip is required")
+	}
+
+	if *email != "" {
+		if err := s.UnlockAccount(ctx, *email); err != nil {
+			return err
+		}
+		fmt.Printf("unlocked %s\n", *email)
+		return nil
+	}
+
+	if err := s.UnlockIp(ctx, *ip); err != nil {
+		return err
+	}
+	fmt.Printf("unlocked %s\n", *ip)
+	return nil
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"auth-strategies/internal/auth"
+	"auth-strategies/internal/config"
+	"auth-strategies/internal/db"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const usage = `usage: import [-format csv|jsonl] <file>
+
+Import users along with their password hashes from another system. Reads from stdin if <file> is -, the format is
+taken from the file extension unless given.
+
+CSV files need a header row with the columns email, first_name, last_name, password_hash and optionally
+email_verified. JSON Lines files hold an object per line with the fields email, firstName, lastName, passwordHash and
+optionally emailVerified.
+
+Supported hashes are argon2id, bcrypt, PBKDF2-SHA256 and scrypt, see the README for their formats. Users already
+registered are skipped.
+`
+
+// jsonlUser a line of a JSON Lines file
+type jsonlUser struct {
+	Email         string `json:"email"`
+	FirstName     string `json:"firstName"`
+	LastName      string `json:"lastName"`
+	PasswordHash  string `json:"passwordHash"`
+	EmailVerified bool   `json:"emailVerified"`
+}
+
+// importFunc import a user read from the given line of the input, or record why it couldn't be read
+type importFunc func(line int, u *auth.ImportedUser, err error)
+
+func main() {
+	config.SetupLogger(config.LogLevelInfo)
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	format := fs.String("format", "", "input format: csv or jsonl")
+	fs.Parse(os.Args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	var read func(io.Reader, importFunc) error
+	switch *format {
+	case "csv":
+		read = readCsv
+	case "jsonl", "ndjson":
+		read = readJsonl
+	default:
+		log.Fatal().Msgf("unknown input format %q, use -format csv or -format jsonl", *format)
+	}
+
+	input := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open input")
+		}
+		defer f.Close()
+		input = f
+	}
+
+	cfg := config.ParseConfig()
+	ctx := context.Background()
+
+	pool, err := db.Connect(ctx, &cfg.Db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("database connection failed")
+	}
+	defer pool.Close()
+
+	authService, err := auth.NewService(ctx, pool, &cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("auth service initialization failed")
+	}
+
+	var imported, skipped, failed int
+	err = read(input, func(line int, u *auth.ImportedUser, err error) {
+		if err == nil {
+			err = authService.ImportUser(ctx, u)
+		}
+		if errors.Is(err, auth.ErrUserExists) {
+			log.Info().Int("line", line).Str("email", u.Email).Msg("user already registered, skipped")
+			skipped++
+		} else if err != nil {
+			log.Error().Err(err).Int("line", line).Msg("failed to import user")
+			failed++
+		} else {
+			imported++
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read input")
+	}
+
+	fmt.Printf("imported %d, skipped %d, failed %d\n", imported, skipped, failed)
+	if err != nil || failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func readCsv(r io.Reader, importUser importFunc) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"email", "first_name", "last_name", "password_hash"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+
+		u := &auth.ImportedUser{
+			Email:        record[columns["email"]],
+			FirstName:    record[columns["first_name"]],
+			LastName:     record[columns["last_name"]],
+			PasswordHash: record[columns["password_hash"]],
+		}
+		if i, ok := columns["email_verified"]; ok && record[i] != "" {
+			u.EmailVerified, err = strconv.ParseBool(record[i])
+			if err != nil {
+				err = fmt.Errorf("invalid email_verified: %w", err)
+			}
+		}
+		importUser(line, u, err)
+	}
+}
+
+func readJsonl(r io.Reader, importUser importFunc) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var ju jsonlUser
+		err := json.Unmarshal(scanner.Bytes(), &ju)
+		u := &auth.ImportedUser{
+			Email:         ju.Email,
+			FirstName:     ju.FirstName,
+			LastName:      ju.LastName,
+			PasswordHash:  ju.PasswordHash,
+			EmailVerified: ju.EmailVerified,
+		}
+		importUser(line, u, err)
+	}
+	return scanner.Err()
+}
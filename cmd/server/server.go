@@ -4,6 +4,8 @@ import (
 	"auth-strategies/internal/auth"
 	"auth-strategies/internal/config"
 	"auth-strategies/internal/db"
+	"auth-strategies/internal/mail"
+	"auth-strategies/internal/ratelimit"
 	"auth-strategies/internal/user"
 	"context"
 	"fmt"
@@ -20,7 +22,13 @@ import (
 	_ "auth-strategies/docs"
 )
 
-func SetupRouter(pool *pgxpool.Pool, sessionStore *scs.SessionManager, hmacSecret []byte) *chi.Mux {
+func SetupRouter(
+	pool *pgxpool.Pool,
+	sessionStore *scs.SessionManager,
+	authService *auth.Service,
+	limiter *ratelimit.Limiter,
+	cfg *config.RateLimitConfig,
+) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	sc := slogchi.Config{
@@ -30,27 +38,76 @@ func SetupRouter(pool *pgxpool.Pool, sessionStore *scs.SessionManager, hmacSecre
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Heartbeat("/health"))
 
+	ipLimit := limiter.Limit("ip", cfg.Ip, ratelimit.ByIp)
+	credentialsLimit := limiter.Limit("credentials", cfg.Credentials, ratelimit.ByIp)
+	userLimit := limiter.Limit("user", cfg.User, ratelimit.ByContext("id"))
+	apiKeyLimit := limiter.Limit("api_key", cfg.ApiKey, ratelimit.ByContext("api_key_id"))
+
 	authRouter := chi.NewRouter()
-	authService := auth.NewService(pool)
-	authApi := auth.NewApi(authService, sessionStore, hmacSecret)
-	authRouter.Post("/register", authApi.Register)
-	authRouter.Post("/login", authApi.Login)
-	authRouter.Post("/token/login", authApi.LoginToken)
+	authApi := auth.NewApi(authService, sessionStore)
+	authRouter.Use(ipLimit, authApi.Csrf)
+	authRouter.Group(func(r chi.Router) {
+		r.Use(credentialsLimit)
+		r.Post("/register", authApi.Register)
+		r.With(authApi.CsrfLogin).Post("/login", authApi.Login)
+		r.Post("/token/login", authApi.LoginToken)
+		r.Post("/token/refresh", authApi.RefreshToken)
+		r.With(authApi.SessionAuth, userLimit).Post("/password", authApi.ChangePassword)
+		r.Post("/password/forgot", authApi.ForgotPassword)
+		r.Post("/password/reset", authApi.ResetPassword)
+		r.Post("/email/verify", authApi.VerifyEmail)
+		r.Post("/email/resend", authApi.ResendEmailVerification)
+		r.Post("/magic-link", authApi.RequestMagicLink)
+		r.Get("/magic-link/login", authApi.MagicLinkPage)
+		r.With(authApi.CsrfLogin).Post("/magic-link/login", authApi.MagicLinkLogin)
+		r.Post("/token/magic-link", authApi.RequestMagicLinkToken)
+		r.Get("/token/magic-link/login", authApi.MagicLinkPage)
+		r.Post("/token/magic-link/login", authApi.MagicLinkLoginToken)
+		r.Post("/mfa/verify", authApi.VerifyMfa)
+		r.With(authApi.CsrfLogin).Post("/webauthn/login/finish", authApi.FinishWebauthnLogin)
+		r.Post("/webauthn/token/login/finish", authApi.FinishWebauthnLoginToken)
+	})
+	authRouter.With(authApi.TokenAuth, userLimit).Post("/token/revoke", authApi.RevokeToken)
 	authRouter.Post("/logout", authApi.Logout)
-	authRouter.With(authApi.SessionAuth).Get("/api-key", authApi.GenerateApiKey)
+	authRouter.With(authApi.SessionAuth, userLimit).Post("/logout/all", authApi.LogoutEverywhere)
+	authRouter.With(authApi.TokenAuth, userLimit).Post("/token/logout/all", authApi.LogoutEverywhereToken)
+	authRouter.With(authApi.SessionAuth, userLimit).Get("/sessions", authApi.ListSessions)
+	authRouter.With(authApi.SessionAuth, userLimit).Delete("/sessions/{sessionId}", authApi.RevokeSession)
+	authRouter.With(authApi.SessionAuth, userLimit).Post("/mfa/totp", authApi.EnrollTotp)
+	authRouter.With(authApi.SessionAuth, userLimit).Post("/mfa/totp/confirm", authApi.ConfirmTotp)
+	authRouter.With(authApi.SessionAuth, userLimit).Post("/mfa/recovery-codes", authApi.RegenerateRecoveryCodes)
+	authRouter.With(authApi.SessionAuth, userLimit).Post("/webauthn/register/begin", authApi.BeginWebauthnRegistration)
+	authRouter.With(authApi.SessionAuth, userLimit).Post("/webauthn/register/finish", authApi.FinishWebauthnRegistration)
+	authRouter.Post("/webauthn/login/begin", authApi.BeginWebauthnLogin)
+	authRouter.Get("/csrf", authApi.CsrfToken)
+	authRouter.With(authApi.SessionAuth, userLimit).Post("/api-key", authApi.GenerateApiKey)
+	authRouter.With(authApi.SessionAuth, userLimit).Get("/api-keys", authApi.ListApiKeys)
+	authRouter.With(authApi.SessionAuth, userLimit).Delete("/api-keys/{publicId}", authApi.RevokeApiKey)
+	authRouter.With(authApi.SessionAuth, userLimit).Post("/api-keys/{publicId}/rotate", authApi.RotateApiKey)
+	authRouter.With(authApi.ApiKeyAuth, apiKeyLimit, auth.RequireScope(auth.ScopeApiKeyRotate)).Post("/api-key/rotate", authApi.RotateOwnApiKey)
 	r.Mount("/auth", authRouter)
+	r.Get("/.well-known/jwks.json", authApi.Jwks)
 
 	userRouter := chi.NewRouter()
+	userRouter.Use(ipLimit, authApi.Csrf)
 	userApi := user.NewApi(user.NewService(pool))
-	userRouter.With(authApi.BasicAuth).Get("/basic", userApi.GetUserInfoBasic)
-	userRouter.With(authApi.SessionAuth).Get("/session", userApi.GetUserInfoSession)
-	userRouter.With(authApi.TokenAuth).Get("/token", userApi.GetUserInfoToken)
-	userRouter.With(authApi.ApiKeyAuth).Get("/api-key", userApi.GetUserInfoApiKey)
+	userRouter.With(credentialsLimit, authApi.BasicAuth, userLimit).Get("/basic", userApi.GetUserInfoBasic)
+	userRouter.With(authApi.SessionAuth, userLimit).Get("/session", userApi.GetUserInfoSession)
+	userRouter.With(authApi.TokenAuth, userLimit).Get("/token", userApi.GetUserInfoToken)
+	userRouter.With(authApi.ApiKeyAuth, apiKeyLimit, auth.RequireScope(auth.ScopeUserRead)).Get("/api-key", userApi.GetUserInfoApiKey)
 	r.Mount("/user", userRouter)
 
 	return r
 }
 
+// SetupAdminRouter routes of the internal listener, which is not meant to be reachable from the public internet
+func SetupAdminRouter() *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Get("/metrics/hashing", auth.HashingMetrics)
+	return r
+}
+
 // @title						Auth Strategies Showcase
 // @version					1
 // @description				These are the API docs for my showcase of auth strategies in Go.
@@ -103,8 +160,33 @@ func main() {
 
 	sessionStore := config.InitSessionStore(pool)
 
-	r := SetupRouter(pool, sessionStore, []byte(cfg.Server.HmacSecret))
+	authService, err := auth.NewService(context.Background(), pool, &cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("auth service initialization failed")
+	}
+	go authService.Run(context.Background())
+
+	mailSender, err := mail.NewSender(&cfg.Mail)
+	if err != nil {
+		log.Fatal().Err(err).Msg("mail sender initialization failed")
+	}
+	go mail.NewOutbox(pool, mailSender, cfg.Mail.PollInterval).Run(context.Background())
+
+	limiter, err := ratelimit.New(&cfg.RateLimit, pool)
+	if err != nil {
+		log.Fatal().Err(err).Msg("rate limiter initialization failed")
+	}
+	go limiter.Run(context.Background())
+
+	r := SetupRouter(pool, sessionStore, authService, limiter, &cfg.RateLimit)
 	r.Get("/*", httpSwagger.Handler())
 
+	if cfg.Server.AdminAddr != "" {
+		go func() {
+			err := http.ListenAndServe(cfg.Server.AdminAddr, SetupAdminRouter())
+			log.Error().Err(err).Msg("admin listener stopped")
+		}()
+	}
+
 	http.ListenAndServe(fmt.Sprintf(":%d", cfg.Server.Port), sessionStore.LoadAndSave(r))
 }
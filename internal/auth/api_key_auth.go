@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"auth-strategies/internal/common"
 	"context"
 	"errors"
 	"fmt"
@@ -23,16 +24,26 @@ func (api *Api) ApiKeyAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		userId, err := api.s.validateApiKey(r.Context(), key)
-		if errors.Is(err, errApiKeyInvalid) {
+		authenticated, err := api.s.validateApiKey(r.Context(), key)
+		if errors.Is(err, errApiKeyExpired) {
+			common.WriteJSON(w, http.StatusUnauthorized, common.ErrorResponse{Error: apiKeyExpired})
+			return
+		} else if errors.Is(err, errApiKeyInvalid) {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
+		} else if errors.Is(err, errHashingBusy) {
+			writeHashingBusy(w)
+			return
 		} else if err != nil {
 			log.Error().Err(err).Msg("admin API key validation failed")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "id", userId)))
+
+		ctx := context.WithValue(r.Context(), "id", &authenticated.userId)
+		ctx = context.WithValue(ctx, "api_key_id", authenticated.publicId)
+		ctx = context.WithValue(ctx, "scopes", authenticated.scopes)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"auth-strategies/internal/config"
+	"auth-strategies/internal/db/repository"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newBenchmarkService(b *testing.B) *Service {
+	cfg := &config.Config{
+		ApiKey: config.ApiKeyConfig{HashKey: "benchmark"},
+		Hashing: config.HashingConfig{
+			MaxQueue: 1024,
+			MaxWait:  time.Minute,
+			Argon2:   config.Argon2Config{Time: 3, Memory: 64 * 1024, Threads: 2, KeyLength: 32, SaltLength: 16},
+		},
+	}
+	h, err := newHasher(&cfg.Hashing)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return &Service{hasher: h, cfg: cfg}
+}
+
+// BenchmarkApiKeyVerification compares the secret verification ApiKeyAuth performs on every request for keys hashed
+// with the legacy argon2 scheme and the HMAC scheme, without the database lookup around it.
+func BenchmarkApiKeyVerification(b *testing.B) {
+	s := newBenchmarkService(b)
+
+	secret, err := generateRandomHex(32)
+	if err != nil {
+		b.Fatal(err)
+	}
+	salt, err := generateSalt()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	hashes := map[string][]byte{
+		apiKeyHashArgon2id:   computeHash(secret, salt),
+		apiKeyHashHmacSha256: s.computeApiKeyHmac(secret),
+	}
+
+	for _, scheme := range []string{apiKeyHashArgon2id, apiKeyHashHmacSha256} {
+		b.Run(scheme, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					valid, err := s.verifyApiKeySecret(context.Background(), scheme, secret, salt, hashes[scheme])
+					if err != nil || !valid {
+						// Fatal must not be called from the goroutines of RunParallel
+						b.Errorf("verification failed: valid=%t err=%v", valid, err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkApiKeyAuth measures requests through the ApiKeyAuth middleware against the test database: keys on the HMAC
+// scheme, and keys on the legacy argon2 scheme that are upgraded to HMAC on their first use.
+func BenchmarkApiKeyAuth(b *testing.B) {
+	pool := testPool(b)
+	s := newBenchmarkService(b)
+	s.pool = pool
+	api := NewApi(s, nil)
+	handler := api.ApiKeyAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	userId, _ := testUser(b, pool)
+	request := func(key string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	b.Run(apiKeyHashHmacSha256, func(b *testing.B) {
+		key, err := s.generateApiKey(context.Background(), &userId, &generateApiKeyRq{scopes: []string{ScopeUserRead}})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if code := request(key); code != http.StatusOK {
+					b.Errorf("status %d", code)
+					return
+				}
+			}
+		})
+	})
+
+	// Every key is only used once, since the first use upgrades it
+	b.Run(apiKeyHashArgon2id+"-upgrade", func(b *testing.B) {
+		keys := make([]string, b.N)
+		for i := range keys {
+			keys[i] = createLegacyApiKey(b, s, &userId)
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for _, key := range keys {
+			if code := request(key); code != http.StatusOK {
+				b.Fatalf("status %d", code)
+			}
+		}
+		b.StopTimer()
+
+		stored, err := repository.New(pool).FindApiKey(context.Background(), keys[0][:32])
+		if err != nil {
+			b.Fatal(err)
+		} else if stored.HashScheme != apiKeyHashHmacSha256 {
+			b.Fatalf("key still on %s after use", stored.HashScheme)
+		}
+	})
+}
+
+// createLegacyApiKey store a key hashed with argon2 the way keys were before the HMAC scheme
+func createLegacyApiKey(b *testing.B, s *Service, userId *uuid.UUID) string {
+	repo := repository.New(s.pool)
+	key, err := _generateApiKey(context.Background(), repo.ApiKeyPublicIdTaken)
+	if err != nil {
+		b.Fatal(err)
+	}
+	salt, err := generateSalt()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	params := repository.CreateApiKeyParams{
+		UserID:     *userId,
+		PublicID:   key.publicId,
+		SecretHash: computeHash(key.secret, salt),
+		SecretSalt: salt,
+		HashScheme: apiKeyHashArgon2id,
+		Scopes:     []string{ScopeUserRead},
+	}
+	if err := repo.CreateApiKey(context.Background(), params); err != nil {
+		b.Fatal(err)
+	}
+	return fmt.Sprintf("%s.%s", key.publicId, key.secret)
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"auth-strategies/internal/common"
 	"context"
 	"encoding/base64"
 	"errors"
@@ -26,17 +27,39 @@ func (api *Api) BasicAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		id, err := api.s.checkPassword(r.Context(), payload.Email, payload.Password)
-		if errors.Is(err, errInvalidCredentials) {
+		var lockout *lockoutError
+		id, err := api.s.checkPassword(r.Context(), payload.Email, payload.Password, clientIp(r))
+		if errors.As(err, &lockout) {
+			writeLockout(w, lockout)
+			return
+		} else if errors.Is(err, errInvalidCredentials) {
 			w.Header().Set("WWW-Authenticate", `Basic realm="user"`)
 			w.WriteHeader(http.StatusUnauthorized)
 			return
+		} else if errors.Is(err, errEmailNotVerified) {
+			common.WriteJSON(w, http.StatusForbidden, common.ErrorResponse{Error: emailNotVerified})
+			return
+		} else if errors.Is(err, errHashingBusy) {
+			writeHashingBusy(w)
+			return
 		} else if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			log.Error().Err(err).Msgf("basic auth failed: %s", err)
 			return
 		}
 
+		// Basic auth sends the password with every request, there is no step where a second factor could be asked for
+		mfaEnabled, err := api.s.mfaEnabled(r.Context(), id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("basic auth failed")
+			return
+		}
+		if mfaEnabled {
+			common.WriteJSON(w, http.StatusUnauthorized, common.ErrorResponse{Error: basicAuthMfaUnsupported})
+			return
+		}
+
 		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "id", id)))
 	})
 }
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// breachedPrefixBits is how many leading bits of a hash select its bucket, the 5 hex digits of the k-anonymity
+	// range API of Pwned Passwords
+	breachedPrefixBits = 20
+	// breachedSuffixLength is how many bytes of each hash are stored, the first two are implied by the bucket
+	breachedSuffixLength = sha1.Size - 2
+)
+
+// breachedPasswords a compact in-memory index of the SHA-1 hashes of breached passwords. Hashes are bucketed by their
+// 20-bit prefix like in the range API of Pwned Passwords, and only the rest of each hash is stored, sorted within its
+// bucket. A lookup is a binary search within a single bucket.
+type breachedPasswords struct {
+	// offsets[b] and offsets[b+1] delimit bucket b in suffixes, counted in suffixes
+	offsets []uint32
+	// suffixes every hash without its first two bytes, back to back
+	suffixes []byte
+}
+
+// loadBreachedPasswords read a file of SHA-1 hashes in hex, one per line, optionally followed by a colon and a count
+// like in the Pwned Passwords downloads
+func loadBreachedPasswords(path string) (*breachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached passwords: %w", err)
+	}
+	defer f.Close()
+
+	var hashes [][sha1.Size]byte
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), ":")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		var hash [sha1.Size]byte
+		if n, err := hex.Decode(hash[:], []byte(text)); err != nil || n != sha1.Size {
+			return nil, fmt.Errorf("invalid SHA-1 hash on line %d of breached passwords", line)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached passwords: %w", err)
+	}
+
+	slices.SortFunc(hashes, func(a, b [sha1.Size]byte) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	hashes = slices.Compact(hashes)
+
+	b := &breachedPasswords{
+		offsets:  make([]uint32, 1<<breachedPrefixBits+1),
+		suffixes: make([]byte, 0, len(hashes)*breachedSuffixLength),
+	}
+	for _, hash := range hashes {
+		b.offsets[breachedBucket(hash)+1]++
+		b.suffixes = append(b.suffixes, hash[2:]...)
+	}
+	for i := 1; i < len(b.offsets); i++ {
+		b.offsets[i] += b.offsets[i-1]
+	}
+	return b, nil
+}
+
+// contains whether the password is one of the breached ones
+func (b *breachedPasswords) contains(password string) bool {
+	hash := sha1.Sum([]byte(password))
+	bucket := breachedBucket(hash)
+	start, end := int(b.offsets[bucket]), int(b.offsets[bucket+1])
+
+	suffix := hash[2:]
+	i := sort.Search(end-start, func(i int) bool {
+		return bytes.Compare(b.suffix(start+i), suffix) >= 0
+	})
+	return start+i < end && bytes.Equal(b.suffix(start+i), suffix)
+}
+
+func (b *breachedPasswords) suffix(i int) []byte {
+	return b.suffixes[i*breachedSuffixLength : (i+1)*breachedSuffixLength]
+}
+
+// breachedBucket the bucket of a hash, its first 20 bits
+func breachedBucket(hash [sha1.Size]byte) int {
+	return int(hash[0])<<12 | int(hash[1])<<4 | int(hash[2])>>4
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"auth-strategies/internal/common"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// csrfHeader the request header state-changing requests of logged in sessions have to carry the CSRF token in
+const csrfHeader = "X-CSRF-Token"
+
+// csrfField the form field HTML forms carry the CSRF token in instead, as they can't set headers
+const csrfField = "csrf_token"
+
+// Csrf reject state-changing requests of logged in sessions that don't carry the CSRF token of the session (see
+// CsrfToken) in the X-CSRF-Token header, or in the csrf_token field of a form. Browsers send the session cookie along
+// with requests other sites make, but those sites can't read the token. Requests authenticated with a bearer token or
+// an API key are exempt, browsers don't add those headers on their own, and so are anonymous sessions, except on the
+// routes logging them in, see CsrfLogin.
+func (api *Api) Csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Basic auth is not exempt, browsers repeat the credentials of a site on their own
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") || r.Header.Get("X-API-Key") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if api.sessionStore.GetString(r.Context(), "user_id") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !api.validCsrfToken(r) {
+			common.WriteJSON(w, http.StatusForbidden, common.ErrorResponse{Error: invalidCsrfToken})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CsrfLogin reject requests without the CSRF token of the session, even if it is anonymous. Used on the routes that log
+// a session in, so that another site can't log the browser of a user into an account of the attacker (login CSRF),
+// whose activity the attacker could then follow.
+func (api *Api) CsrfLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !api.validCsrfToken(r) {
+			common.WriteJSON(w, http.StatusForbidden, common.ErrorResponse{Error: invalidCsrfToken})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validCsrfToken whether the request carries the CSRF token of its session
+func (api *Api) validCsrfToken(r *http.Request) bool {
+	token := api.sessionStore.GetString(r.Context(), "csrf_token")
+	sent := r.Header.Get(csrfHeader)
+	if sent == "" {
+		sent = r.PostFormValue(csrfField)
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(sent)) == 1
+}
+
+// csrfToken the CSRF token of the session of the request, generated on first use
+func (api *Api) csrfToken(r *http.Request) (string, error) {
+	if token := api.sessionStore.GetString(r.Context(), "csrf_token"); token != "" {
+		return token, nil
+	}
+
+	token, err := generateRandomHex(32)
+	if err != nil {
+		return "", err
+	}
+	api.sessionStore.Put(r.Context(), "csrf_token", token)
+	return token, nil
+}
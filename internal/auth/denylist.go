@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// denylist in-process cache of the revoked_token table, keyed on the jti of the revoked access tokens, and of the
+// token_cutoff table, keyed on the id of the users whose every access token up to a point in time was revoked.
+//
+// Access tokens are short-lived, so the list of revoked but unexpired tokens stays small enough for every server
+// instance to keep all of it in memory and reload it periodically, instead of querying the database on every request.
+// Revocations are never undone, so entries only ever leave the list once the token they refer to has expired.
+type denylist struct {
+	mu      sync.RWMutex
+	entries map[uuid.UUID]time.Time
+	cutoffs map[uuid.UUID]tokenCutoff
+}
+
+// tokenCutoff access tokens of a user issued up to revokedBefore are revoked, until expiresAt when all of them have
+// expired anyway
+type tokenCutoff struct {
+	revokedBefore time.Time
+	expiresAt     time.Time
+}
+
+func newDenylist() *denylist {
+	return &denylist{
+		entries: make(map[uuid.UUID]time.Time),
+		cutoffs: make(map[uuid.UUID]tokenCutoff),
+	}
+}
+
+func (d *denylist) contains(jti uuid.UUID) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.entries[jti]
+	return ok
+}
+
+func (d *denylist) add(jti uuid.UUID, expiresAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[jti] = expiresAt
+}
+
+// cutOff whether an access token of the user issued at issuedAt was revoked by a cutoff. issuedAt only has a
+// resolution of seconds, so tokens issued in the same second as the cutoff are revoked too.
+func (d *denylist) cutOff(userId uuid.UUID, issuedAt time.Time) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	cutoff, ok := d.cutoffs[userId]
+	return ok && !issuedAt.After(cutoff.revokedBefore)
+}
+
+func (d *denylist) addCutoff(userId uuid.UUID, cutoff tokenCutoff) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cutoff.revokedBefore.After(d.cutoffs[userId].revokedBefore) {
+		d.cutoffs[userId] = cutoff
+	}
+}
+
+// sync delete expired revocations from the database, then merge the remaining ones into the cache and drop expired
+// entries from it. Merging rather than replacing keeps local revocations that happened while the query was running.
+func (d *denylist) sync(ctx context.Context, repo *repository.Queries) error {
+	if _, err := repo.DeleteExpiredRevokedTokens(ctx); err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	if _, err := repo.DeleteExpiredTokenCutoffs(ctx); err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	rows, err := repo.ListRevokedTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	cutoffRows, err := repo.ListTokenCutoffs(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, row := range rows {
+		d.entries[row.Jti] = row.ExpiresAt
+	}
+	for jti, expiresAt := range d.entries {
+		if !now.Before(expiresAt) {
+			delete(d.entries, jti)
+		}
+	}
+	for _, row := range cutoffRows {
+		if row.RevokedBefore.After(d.cutoffs[row.UserID].revokedBefore) {
+			d.cutoffs[row.UserID] = tokenCutoff{revokedBefore: row.RevokedBefore, expiresAt: row.ExpiresAt}
+		}
+	}
+	for userId, cutoff := range d.cutoffs {
+		if !now.Before(cutoff.expiresAt) {
+			delete(d.cutoffs, userId)
+		}
+	}
+	return nil
+}
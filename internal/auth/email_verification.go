@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"auth-strategies/internal/mail"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	emailVerificationTokenLifetime = 24 * time.Hour
+	// emailVerificationResendInterval is how long a user has to wait before another verification token is sent
+	emailVerificationResendInterval = time.Minute
+)
+
+var (
+	errEmailNotVerified         = errors.New("email not verified")
+	errVerificationTokenInvalid = errors.New("invalid email verification token")
+)
+
+// resendEmailVerification send a new verification token to an unverified email address. Unknown and verified
+// addresses are silently ignored, and so are requests arriving sooner than emailVerificationResendInterval after the
+// previous token, so that the response doesn't reveal anything about the address.
+func (s *Service) resendEmailVerification(ctx context.Context, email string) error {
+	repo := repository.New(s.pool)
+
+	user, err := repo.FindUserEmailVerification(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	params := repository.LastOneTimeTokenCreatedAtParams{
+		UserID:  user.ID,
+		Purpose: tokenPurposeEmailVerification,
+	}
+	lastSentAt, err := repo.LastOneTimeTokenCreatedAt(ctx, params)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if err == nil && time.Since(lastSentAt) < emailVerificationResendInterval {
+		return nil
+	}
+
+	token, err := createOneTimeToken(ctx, repo, user.ID, tokenPurposeEmailVerification, emailVerificationTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	data := mail.TokenData{Token: token, ValidFor: emailVerificationTokenLifetime}
+	return enqueueMail(ctx, repo, email, mail.TemplateEmailVerification, data)
+}
+
+// verifyEmail mark the email address a verification token was sent to as verified
+func (s *Service) verifyEmail(ctx context.Context, token string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	userId, err := consumeOneTimeToken(ctx, repo, tokenPurposeEmailVerification, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errVerificationTokenInvalid
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	if err := repo.MarkEmailVerified(ctx, userId); err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
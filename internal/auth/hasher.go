@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"auth-strategies/internal/config"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var (
+	errHashingBusy = errors.New("too many concurrent password hashes")
+)
+
+// Served by HashingMetrics. The average wait is hashing_wait_seconds / hashing_acquired.
+var (
+	hashingActive      = expvar.NewInt("hashing_active")
+	hashingQueueDepth  = expvar.NewInt("hashing_queue_depth")
+	hashingAcquired    = expvar.NewInt("hashing_acquired")
+	hashingRejected    = expvar.NewInt("hashing_rejected")
+	hashingWaitSeconds = expvar.NewFloat("hashing_wait_seconds")
+)
+
+// hashingVars the names of the hashing counters, in the order HashingMetrics writes them
+var hashingVars = []string{
+	"hashing_active",
+	"hashing_queue_depth",
+	"hashing_acquired",
+	"hashing_rejected",
+	"hashing_wait_seconds",
+}
+
+// HashingMetrics write the hashing counters as a JSON object. Unlike expvar.Handler, it leaves out the command line
+// and memory statistics of the process, it is still meant for an internal listener only.
+func HashingMetrics(w http.ResponseWriter, r *http.Request) {
+	fields := make([]string, 0, len(hashingVars))
+	for _, name := range hashingVars {
+		fields = append(fields, fmt.Sprintf("%q: %s", name, expvar.Get(name).String()))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{%s}\n", strings.Join(fields, ", "))
+}
+
+// hasher compute argon2 hashes with bounded concurrency, so that a burst of logins can't exhaust the memory of the
+// server. Callers wait in a bounded queue for a free slot, and get errHashingBusy if the queue is full or the wait
+// takes too long.
+type hasher struct {
+	slots   chan struct{}
+	queue   chan struct{}
+	maxWait time.Duration
+	// params of new password hashes
+	params argon2Params
+}
+
+func newHasher(cfg *config.HashingConfig) (*hasher, error) {
+	params, err := newArgon2Params(&cfg.Argon2)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConcurrent := cfg.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = runtime.NumCPU()
+	}
+	return &hasher{
+		slots:   make(chan struct{}, maxConcurrent),
+		queue:   make(chan struct{}, max(cfg.MaxQueue, 0)),
+		maxWait: cfg.MaxWait,
+		params:  params,
+	}, nil
+}
+
+// hash compute the argon2 hash of s with the fixed parameters of computeHash once a slot is free
+func (h *hasher) hash(ctx context.Context, s string, salt []byte) ([]byte, error) {
+	if err := h.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer h.release()
+	return computeHash(s, salt), nil
+}
+
+// hashPassword hash a password with the configured parameters once a slot is free
+func (h *hasher) hashPassword(ctx context.Context, password string) (string, error) {
+	if err := h.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer h.release()
+	return hashPassword(password, h.params)
+}
+
+// verifyPassword check a password against its stored hash once a slot is free, see verifyPassword
+func (h *hasher) verifyPassword(ctx context.Context, password, encoded string) (bool, bool, error) {
+	if err := h.acquire(ctx); err != nil {
+		return false, false, err
+	}
+	defer h.release()
+	return verifyPassword(password, encoded, h.params)
+}
+
+func (h *hasher) acquire(ctx context.Context) error {
+	start := time.Now()
+	select {
+	case h.slots <- struct{}{}:
+		h.acquired(start)
+		return nil
+	default:
+	}
+
+	select {
+	case h.queue <- struct{}{}:
+	default:
+		hashingRejected.Add(1)
+		return errHashingBusy
+	}
+	hashingQueueDepth.Add(1)
+	defer func() {
+		<-h.queue
+		hashingQueueDepth.Add(-1)
+	}()
+
+	timer := time.NewTimer(h.maxWait)
+	defer timer.Stop()
+
+	select {
+	case h.slots <- struct{}{}:
+		h.acquired(start)
+		return nil
+	case <-timer.C:
+		hashingRejected.Add(1)
+		return errHashingBusy
+	case <-ctx.Done():
+		hashingRejected.Add(1)
+		return fmt.Errorf("%w: %w", errHashingBusy, ctx.Err())
+	}
+}
+
+func (h *hasher) acquired(start time.Time) {
+	hashingActive.Add(1)
+	hashingAcquired.Add(1)
+	hashingWaitSeconds.Add(time.Since(start).Seconds())
+}
+
+func (h *hasher) release() {
+	hashingActive.Add(-1)
+	<-h.slots
+}
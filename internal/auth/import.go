@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUserExists a user with the email address of an imported user is already registered
+	ErrUserExists = errors.New("user already exists")
+)
+
+// ImportedUser a user migrated from another system, along with their password hash in any supported format
+type ImportedUser struct {
+	Email         string
+	FirstName     string
+	LastName      string
+	PasswordHash  string
+	EmailVerified bool
+}
+
+// ImportUser create a user with the password hash of another system, without knowing the password. The hash is kept as
+// it is until the first successful login of the user, which replaces it with an argon2id hash.
+func (s *Service) ImportUser(ctx context.Context, u *ImportedUser) error {
+	if err := ValidatePasswordHash(u.PasswordHash); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	emailTaken, err := repo.EmailTaken(ctx, u.Email)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if emailTaken {
+		return ErrUserExists
+	}
+
+	createUserParams := repository.CreateUserParams{
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+	}
+	userId, err := repo.CreateUser(ctx, createUserParams)
+	if err != nil {
+		return fmt.Errorf("failed creating user: %w", err)
+	}
+
+	// The other system hashed the password as it was typed, it is normalized once it is rehashed on login
+	createPasswordAuthParams := repository.CreatePasswordAuthParams{
+		UserID:       userId,
+		PwHash:       u.PasswordHash,
+		PwNormalized: false,
+	}
+	if err := repo.CreatePasswordAuth(ctx, createPasswordAuthParams); err != nil {
+		return fmt.Errorf("failed to create password auth: %w", err)
+	}
+
+	// Users whose address the other system hasn't verified can ask for a verification token via /auth/email/resend
+	if u.EmailVerified {
+		if err := repo.MarkEmailVerified(ctx, userId); err != nil {
+			return fmt.Errorf("failed to mark email verified: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// keyRing the set of keys access tokens are signed and verified with.
+//
+// Keys stored in the database rotate without downtime: a new key is published for verification before it activates,
+// so every server instance and every consumer of the JWKS endpoint knows it by the time the first token is signed
+// with it. A key signs tokens from its activation until it is retired or a newer key activates, and stays valid for
+// verification until the last token it signed has expired.
+//
+// The key from the config file is the fallback: it signs whenever no database key is active. Like a retired database
+// key, it stays valid until the last token it signed has expired, so once a database key activates, the fallback is
+// retired along with it: a leaked config key can be replaced by adding a key to the ring.
+type keyRing struct {
+	mu       sync.RWMutex
+	fallback *signingKey
+	keys     []*ringKey
+}
+
+type ringKey struct {
+	*signingKey
+	activatesAt time.Time
+	retiresAt   *time.Time
+	// signsUntil is the end of the signing period, either the retirement of the key or the activation of the next one
+	signsUntil *time.Time
+}
+
+func (k *ringKey) verifiableUntil() *time.Time {
+	if k.signsUntil == nil {
+		return nil
+	}
+	t := k.signsUntil.Add(accessTokenLifetime)
+	return &t
+}
+
+func (k *ringKey) signsAt(now time.Time) bool {
+	return !now.Before(k.activatesAt) && (k.signsUntil == nil || now.Before(*k.signsUntil))
+}
+
+func (k *ringKey) verifiesAt(now time.Time) bool {
+	until := k.verifiableUntil()
+	return until == nil || now.Before(*until)
+}
+
+func newKeyRing(fallback *signingKey) *keyRing {
+	return &keyRing{fallback: fallback}
+}
+
+// load replace the database keys of the ring with the current contents of the signing_key table
+func (kr *keyRing) load(ctx context.Context, repo *repository.Queries) error {
+	rows, err := repo.ListSigningKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	keys := make([]*ringKey, 0, len(rows))
+	for _, row := range rows {
+		privateKey, err := parsePrivateKeyPEM([]byte(row.PrivateKey))
+		if err != nil {
+			log.Error().Err(err).Str("kid", row.Kid).Msg("skipping unparsable signing key")
+			continue
+		}
+		key, err := newAsymmetricSigningKey(row.Kid, privateKey)
+		if err != nil {
+			log.Error().Err(err).Str("kid", row.Kid).Msg("skipping unsupported signing key")
+			continue
+		}
+		keys = append(keys, &ringKey{signingKey: key, activatesAt: row.ActivatesAt, retiresAt: row.RetiresAt})
+	}
+	computeSigningPeriods(keys)
+
+	kr.mu.Lock()
+	kr.keys = keys
+	kr.mu.Unlock()
+	return nil
+}
+
+// computeSigningPeriods set signsUntil of keys ordered by activation time. A key retired before it activated never
+// signs, so it does not end the signing period of its predecessor either.
+func computeSigningPeriods(keys []*ringKey) {
+	var next *ringKey
+	for i := len(keys) - 1; i >= 0; i-- {
+		k := keys[i]
+		k.signsUntil = k.retiresAt
+		if next != nil && (k.signsUntil == nil || next.activatesAt.Before(*k.signsUntil)) {
+			k.signsUntil = &next.activatesAt
+		}
+		if k.retiresAt == nil || k.retiresAt.After(k.activatesAt) {
+			next = k
+		}
+	}
+}
+
+// signing return the key new tokens should be signed with
+func (kr *keyRing) signing() *signingKey {
+	now := time.Now()
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	for i := len(kr.keys) - 1; i >= 0; i-- {
+		if kr.keys[i].signsAt(now) {
+			return kr.keys[i].signingKey
+		}
+	}
+	return kr.fallback
+}
+
+// fallbackVerifiesAt whether the fallback signed tokens at any point within the access token lifetime before now, that
+// is, whether no database key signed during part of that time. Callers must hold kr.mu.
+func (kr *keyRing) fallbackVerifiesAt(now time.Time) bool {
+	since := now.Add(-accessTokenLifetime)
+	// A gap in the signing periods of the database keys starts either at since, or at the end of one of the periods
+	gapStarts := []time.Time{since}
+	for _, k := range kr.keys {
+		if k.signsUntil != nil && k.signsUntil.After(since) && !k.signsUntil.After(now) {
+			gapStarts = append(gapStarts, *k.signsUntil)
+		}
+	}
+	for _, t := range gapStarts {
+		if !kr.signsAt(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// signsAt whether any database key signs at t. Callers must hold kr.mu.
+func (kr *keyRing) signsAt(t time.Time) bool {
+	for _, k := range kr.keys {
+		if k.signsAt(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// verification look up the key with the given id among the keys tokens may currently be verified with
+func (kr *keyRing) verification(kid string) (*signingKey, bool) {
+	now := time.Now()
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if kid == kr.fallback.id && kr.fallbackVerifiesAt(now) {
+		return kr.fallback, true
+	}
+	for _, k := range kr.keys {
+		if k.id == kid && k.verifiesAt(now) {
+			return k.signingKey, true
+		}
+	}
+	return nil, false
+}
+
+// verificationKeys return every key tokens may currently be verified with, including keys not yet active
+func (kr *keyRing) verificationKeys() []*signingKey {
+	now := time.Now()
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	var keys []*signingKey
+	if kr.fallbackVerifiesAt(now) {
+		keys = append(keys, kr.fallback)
+	}
+	for _, k := range kr.keys {
+		if k.verifiesAt(now) {
+			keys = append(keys, k.signingKey)
+		}
+	}
+	return keys
+}
+
+const (
+	SigningKeyPending   = "pending"
+	SigningKeyActive    = "active"
+	SigningKeyVerifying = "verifying"
+	SigningKeyExpired   = "expired"
+)
+
+// SigningKeyInfo state of a key of the key ring, for administration purposes
+type SigningKeyInfo struct {
+	Kid             string
+	Algorithm       string
+	Status          string
+	ActivatesAt     time.Time
+	SignsUntil      *time.Time
+	VerifiableUntil *time.Time
+}
+
+var (
+	errUnknownAlgorithm  = errors.New("unknown signing algorithm")
+	ErrSigningKeyUnknown = errors.New("signing key not found")
+)
+
+// AddSigningKey generate a key for the given algorithm (EdDSA, ES256 or RS256) and add it to the key ring, activating
+// it after activateIn. The delay should exceed the key refresh interval of the servers and the cache lifetime of the
+// JWKS endpoint, so that every verifier knows the key before tokens signed with it appear.
+func (s *Service) AddSigningKey(ctx context.Context, algorithm string, activateIn time.Duration) (string, error) {
+	privateKey, err := generateSigningKey(algorithm)
+	if err != nil {
+		return "", err
+	}
+	key, err := newAsymmetricSigningKey("", privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	repo := repository.New(s.pool)
+	params := repository.CreateSigningKeyParams{
+		Kid:         key.id,
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ActivatesAt: time.Now().Add(activateIn),
+	}
+	if err := repo.CreateSigningKey(ctx, params); err != nil {
+		return "", fmt.Errorf("failed to create signing key: %w", err)
+	}
+
+	return key.id, nil
+}
+
+// ListSigningKeys describe every key stored in the database
+func (s *Service) ListSigningKeys(ctx context.Context) ([]SigningKeyInfo, error) {
+	kr := newKeyRing(s.keys.fallback)
+	if err := kr.load(ctx, repository.New(s.pool)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	infos := make([]SigningKeyInfo, 0, len(kr.keys))
+	for _, k := range kr.keys {
+		info := SigningKeyInfo{
+			Kid:             k.id,
+			Algorithm:       k.method.Alg(),
+			ActivatesAt:     k.activatesAt,
+			SignsUntil:      k.signsUntil,
+			VerifiableUntil: k.verifiableUntil(),
+		}
+		switch {
+		case !k.verifiesAt(now):
+			info.Status = SigningKeyExpired
+		case now.Before(k.activatesAt):
+			info.Status = SigningKeyPending
+		case k.signsAt(now):
+			info.Status = SigningKeyActive
+		default:
+			info.Status = SigningKeyVerifying
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// RetireSigningKey stop signing tokens with a key. Tokens it has already signed stay valid until they expire.
+func (s *Service) RetireSigningKey(ctx context.Context, kid string) error {
+	repo := repository.New(s.pool)
+	retired, err := repo.RetireSigningKey(ctx, kid)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if retired == 0 {
+		return ErrSigningKeyUnknown
+	}
+	return nil
+}
+
+// RevokeSigningKey delete a key immediately, invalidating every token it has signed. Meant for compromised keys.
+func (s *Service) RevokeSigningKey(ctx context.Context, kid string) error {
+	repo := repository.New(s.pool)
+	deleted, err := repo.DeleteSigningKey(ctx, kid)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if deleted == 0 {
+		return ErrSigningKeyUnknown
+	}
+	return nil
+}
+
+// PruneSigningKeys delete keys that can no longer verify any unexpired token, return their ids
+func (s *Service) PruneSigningKeys(ctx context.Context) ([]string, error) {
+	infos, err := s.ListSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := repository.New(s.pool)
+	var pruned []string
+	for _, info := range infos {
+		if info.Status != SigningKeyExpired {
+			continue
+		}
+		if _, err := repo.DeleteSigningKey(ctx, info.Kid); err != nil {
+			return pruned, fmt.Errorf("%w: %w", errDb, err)
+		}
+		pruned = append(pruned, info.Kid)
+	}
+	return pruned, nil
+}
+
+func generateSigningKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case "EdDSA":
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 3072)
+	}
+	return nil, fmt.Errorf("%w: %q", errUnknownAlgorithm, algorithm)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFallbackRetirement the key from the config file stays valid only until the tokens it signed before a key of the
+// database ring activated have expired, so that a leaked config key can be replaced like any other.
+func TestFallbackRetirement(t *testing.T) {
+	now := time.Now()
+	fallback := newHmacSigningKey("", []byte("test"))
+	ringKeyAt := func(kid string, activatesAt time.Time, retiresAt *time.Time) *ringKey {
+		return &ringKey{signingKey: newHmacSigningKey(kid, []byte(kid)), activatesAt: activatesAt, retiresAt: retiresAt}
+	}
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+
+	tests := []struct {
+		name     string
+		keys     []*ringKey
+		signs    bool
+		verifies bool
+	}{
+		{"no database key", nil, true, true},
+		{"database key pending", []*ringKey{ringKeyAt("a", now.Add(time.Minute), nil)}, true, true},
+		{
+			"database key activated recently",
+			[]*ringKey{ringKeyAt("a", now.Add(-time.Minute), nil)},
+			false, true,
+		},
+		{
+			"database key activated a token lifetime ago",
+			[]*ringKey{ringKeyAt("a", now.Add(-accessTokenLifetime-time.Minute), nil)},
+			false, false,
+		},
+		{
+			"database keys rotated a token lifetime ago",
+			[]*ringKey{
+				ringKeyAt("a", now.Add(-2*accessTokenLifetime), nil),
+				ringKeyAt("b", now.Add(-accessTokenLifetime), nil),
+			},
+			false, false,
+		},
+		{
+			"database key retired recently",
+			[]*ringKey{ringKeyAt("a", now.Add(-2*accessTokenLifetime), ago(time.Minute))},
+			true, true,
+		},
+		{
+			"database key retired within the token lifetime, then replaced",
+			[]*ringKey{
+				ringKeyAt("a", now.Add(-2*accessTokenLifetime), ago(accessTokenLifetime/2)),
+				ringKeyAt("b", now.Add(-accessTokenLifetime/4), nil),
+			},
+			false, true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kr := newKeyRing(fallback)
+			computeSigningPeriods(test.keys)
+			kr.keys = test.keys
+
+			if signs := kr.signing() == fallback; signs != test.signs {
+				t.Errorf("fallback signs: %t, want %t", signs, test.signs)
+			}
+			if _, verifies := kr.verification(fallback.id); verifies != test.verifies {
+				t.Errorf("fallback verifies: %t, want %t", verifies, test.verifies)
+			}
+			published := false
+			for _, key := range kr.verificationKeys() {
+				published = published || key == fallback
+			}
+			if published != test.verifies {
+				t.Errorf("fallback published: %t, want %t", published, test.verifies)
+			}
+		})
+	}
+}
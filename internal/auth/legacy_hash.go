@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"strconv"
+	"strings"
+)
+
+// Verifiers of the hashes of legacy systems, only ever used for imported users until their first login
+
+// bcryptHasher verifies bcrypt hashes in the modular crypt format, e.g. $2b$12$<salt and hash>
+type bcryptHasher struct{}
+
+// bcryptMaxPasswordLength bcrypt ignores anything after the first 72 bytes of a password
+const bcryptMaxPasswordLength = 72
+
+func (bcryptHasher) verify(password, encoded string) (bool, error) {
+	// Refusing longer passwords is safer than accepting anything sharing their prefix. CompareHashAndPassword doesn't,
+	// only GenerateFromPassword does.
+	if len(password) > bcryptMaxPasswordLength {
+		return false, nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("%w: %w", errInvalidPasswordHash, err)
+	}
+	return true, nil
+}
+
+func (bcryptHasher) validate(encoded string) error {
+	if _, err := bcrypt.Cost([]byte(encoded)); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidPasswordHash, err)
+	}
+	return nil
+}
+
+// pbkdf2Sha256Hasher verifies PBKDF2-HMAC-SHA256 hashes, e.g. $pbkdf2-sha256$i=600000$<salt>$<hash>. The iteration
+// count may also be given without the i= prefix, and salt and hash may use the . of passlib's base64 alphabet instead
+// of +, so that passlib hashes can be imported as they are.
+type pbkdf2Sha256Hasher struct{}
+
+func (pbkdf2Sha256Hasher) verify(password, encoded string) (bool, error) {
+	iterations, salt, key, err := decodePbkdf2Sha256Hash(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	computed, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errInvalidPasswordHash, err)
+	}
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (pbkdf2Sha256Hasher) validate(encoded string) error {
+	_, _, _, err := decodePbkdf2Sha256Hash(encoded)
+	return err
+}
+
+func decodePbkdf2Sha256Hash(encoded string) (int, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[0] != "" {
+		return 0, nil, nil, fmt.Errorf("%w: not in PHC string format", errInvalidPasswordHash)
+	}
+
+	iterations, err := strconv.Atoi(strings.TrimPrefix(parts[2], "i="))
+	if err != nil || iterations < 1 {
+		return 0, nil, nil, fmt.Errorf("%w: invalid iteration count %q", errInvalidPasswordHash, parts[2])
+	}
+
+	salt, err := decodeLegacyBase64(parts[3])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("%w: invalid salt: %w", errInvalidPasswordHash, err)
+	}
+	key, err := decodeLegacyBase64(parts[4])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("%w: invalid hash: %w", errInvalidPasswordHash, err)
+	}
+	if len(key) == 0 {
+		return 0, nil, nil, fmt.Errorf("%w: empty hash", errInvalidPasswordHash)
+	}
+
+	return iterations, salt, key, nil
+}
+
+// scryptHasher verifies scrypt hashes, e.g. $scrypt$ln=15,r=8,p=1$<salt>$<hash>, where ln is the base 2 logarithm of
+// the cost parameter N
+type scryptHasher struct{}
+
+type scryptParams struct {
+	logN int
+	r    int
+	p    int
+}
+
+func (scryptHasher) verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeScryptHash(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	computed, err := scrypt.Key([]byte(password), salt, 1<<params.logN, params.r, params.p, len(key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errInvalidPasswordHash, err)
+	}
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (scryptHasher) validate(encoded string) error {
+	_, _, _, err := decodeScryptHash(encoded)
+	return err
+}
+
+func decodeScryptHash(encoded string) (scryptParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[0] != "" {
+		return scryptParams{}, nil, nil, fmt.Errorf("%w: not in PHC string format", errInvalidPasswordHash)
+	}
+
+	var p scryptParams
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &p.logN, &p.r, &p.p); err != nil {
+		return scryptParams{}, nil, nil, fmt.Errorf("%w: invalid parameters: %w", errInvalidPasswordHash, err)
+	}
+	// scrypt.Key rejects the other invalid combinations itself, this keeps 1<<logN from overflowing
+	if p.logN < 1 || p.logN > 30 || p.r < 1 || p.p < 1 {
+		return scryptParams{}, nil, nil, fmt.Errorf("%w: invalid parameters %q", errInvalidPasswordHash, parts[2])
+	}
+
+	salt, err := decodeLegacyBase64(parts[3])
+	if err != nil {
+		return scryptParams{}, nil, nil, fmt.Errorf("%w: invalid salt: %w", errInvalidPasswordHash, err)
+	}
+	key, err := decodeLegacyBase64(parts[4])
+	if err != nil {
+		return scryptParams{}, nil, nil, fmt.Errorf("%w: invalid hash: %w", errInvalidPasswordHash, err)
+	}
+	if len(key) == 0 {
+		return scryptParams{}, nil, nil, fmt.Errorf("%w: empty hash", errInvalidPasswordHash)
+	}
+
+	return p, salt, key, nil
+}
+
+// decodeLegacyBase64 decode the unpadded base64 of the PHC string format, also accepting the . of passlib's alphabet
+// in place of +
+func decodeLegacyBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.ReplaceAll(s, ".", "+"))
+}
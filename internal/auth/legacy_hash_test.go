@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// TestBcryptLongPassword bcrypt only hashes the first 72 bytes of a password, longer passwords sharing them must not
+// be accepted in place of the real one
+func TestBcryptLongPassword(t *testing.T) {
+	password := strings.Repeat("a", bcryptMaxPasswordLength)
+	encoded, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"real password", password, true},
+		{"longer password with the same prefix", password + "b", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			valid, err := bcryptHasher{}.verify(test.password, string(encoded))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valid != test.valid {
+				t.Fatalf("valid: %t, want %t", valid, test.valid)
+			}
+		})
+	}
+}
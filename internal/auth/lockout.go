@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"auth-strategies/internal/config"
+	"auth-strategies/internal/db/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// Kinds of failed login counters
+const (
+	loginKindAccount = "account"
+	loginKindIp      = "ip"
+	// loginKindMfa counts wrong second factors per user, across all of their MFA challenges
+	loginKindMfa = "mfa"
+)
+
+var (
+	ErrNoLoginFailures = errors.New("no failed logins recorded")
+)
+
+// lockoutError a login refused without checking the password, after too many failed attempts
+type lockoutError struct {
+	until time.Time
+}
+
+func (e *lockoutError) Error() string {
+	return "login locked out until " + e.until.Format(time.RFC3339)
+}
+
+// Failed logins are counted per email address rather than per user, so that unknown addresses are locked out the same
+// way, and the lockout doesn't reveal which addresses are registered
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginLockout return a *lockoutError if either the email address or the IP address is locked out
+func checkLoginLockout(ctx context.Context, repo *repository.Queries, email string, ip string) error {
+	params := repository.ListLoginLocksParams{
+		Email: normalizeEmail(email),
+		Ip:    ip,
+	}
+	locks, err := repo.ListLoginLocks(ctx, params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	var until time.Time
+	for _, lockedUntil := range locks {
+		if lockedUntil != nil && lockedUntil.After(until) {
+			until = *lockedUntil
+		}
+	}
+	if until.IsZero() {
+		return nil
+	}
+	return &lockoutError{until}
+}
+
+// recordLoginFailure count a failed login against both the email address and the IP address, and lock out those that
+// reached their threshold
+func (s *Service) recordLoginFailure(ctx context.Context, repo *repository.Queries, email string, ip string) error {
+	cfg := &s.cfg.Lockout
+	now := time.Now()
+
+	// Counters past their window would start over anyway, so they are cleaned up opportunistically
+	if err := repo.DeleteStaleLoginFailures(ctx, now.Add(-cfg.FailureWindow)); err != nil {
+		return fmt.Errorf("failed to delete stale login failures: %w", err)
+	}
+
+	counters := []struct {
+		kind      string
+		subject   string
+		threshold int
+	}{
+		{loginKindAccount, normalizeEmail(email), cfg.AccountThreshold},
+		{loginKindIp, ip, cfg.IpThreshold},
+	}
+	for _, counter := range counters {
+		if err := s.recordFailure(ctx, repo, counter.kind, counter.subject, counter.threshold, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordFailure count a failure against a single subject, and lock it out once it reached the threshold
+func (s *Service) recordFailure(
+	ctx context.Context,
+	repo *repository.Queries,
+	kind string,
+	subject string,
+	threshold int,
+	now time.Time,
+) error {
+	cfg := &s.cfg.Lockout
+	params := repository.RecordLoginFailureParams{
+		Kind:        kind,
+		Subject:     subject,
+		WindowStart: now.Add(-cfg.FailureWindow),
+	}
+	failures, err := repo.RecordLoginFailure(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+	if int(failures) < threshold {
+		return nil
+	}
+
+	lockedUntil := now.Add(lockoutDuration(cfg, int(failures)-threshold))
+	lockParams := repository.LockLoginParams{
+		Kind:        kind,
+		Subject:     subject,
+		LockedUntil: &lockedUntil,
+	}
+	if err := repo.LockLogin(ctx, lockParams); err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	return nil
+}
+
+// lockoutDuration how long to lock out after excess failures beyond the threshold
+func lockoutDuration(cfg *config.LockoutConfig, excess int) time.Duration {
+	duration := cfg.BaseDuration
+	for range excess {
+		if duration >= cfg.MaxDuration {
+			break
+		}
+		duration *= 2
+	}
+	return min(duration, cfg.MaxDuration)
+}
+
+// clearLoginFailures forget the failed logins of the email address after a successful login. Failures of the IP
+// address are kept, otherwise an attacker could reset them by logging into an account of their own.
+func clearLoginFailures(ctx context.Context, repo *repository.Queries, email string) error {
+	params := repository.ClearLoginFailuresParams{
+		Kind:    loginKindAccount,
+		Subject: normalizeEmail(email),
+	}
+	if _, err := repo.ClearLoginFailures(ctx, params); err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+	return nil
+}
+
+// checkMfaLockout return a *lockoutError if the second factor of the user is locked out
+func checkMfaLockout(ctx context.Context, repo *repository.Queries, userId uuid.UUID) error {
+	params := repository.FindLoginLockParams{
+		Kind:    loginKindMfa,
+		Subject: userId.String(),
+	}
+	lockedUntil, err := repo.FindLoginLock(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && lockedUntil == nil) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	return &lockoutError{*lockedUntil}
+}
+
+// recordMfaFailure count a wrong second factor against the user. The count outlives the challenge, so that starting
+// over with the password doesn't grant further guesses.
+func (s *Service) recordMfaFailure(ctx context.Context, repo *repository.Queries, userId uuid.UUID) error {
+	now := time.Now()
+	if err := repo.DeleteStaleLoginFailures(ctx, now.Add(-s.cfg.Lockout.FailureWindow)); err != nil {
+		return fmt.Errorf("failed to delete stale login failures: %w", err)
+	}
+	return s.recordFailure(ctx, repo, loginKindMfa, userId.String(), s.cfg.Lockout.MfaThreshold, now)
+}
+
+// clearMfaFailures forget the wrong second factors of the user after a successful login
+func clearMfaFailures(ctx context.Context, repo *repository.Queries, userId uuid.UUID) error {
+	params := repository.ClearLoginFailuresParams{
+		Kind:    loginKindMfa,
+		Subject: userId.String(),
+	}
+	if _, err := repo.ClearLoginFailures(ctx, params); err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+	return nil
+}
+
+// UnlockAccount forget the failed logins of an email address, lifting its lockout
+func (s *Service) UnlockAccount(ctx context.Context, email string) error {
+	return s.unlock(ctx, loginKindAccount, normalizeEmail(email))
+}
+
+// UnlockIp forget the failed logins of an IP address, lifting its lockout
+func (s *Service) UnlockIp(ctx context.Context, ip string) error {
+	return s.unlock(ctx, loginKindIp, ip)
+}
+
+func (s *Service) unlock(ctx context.Context, kind string, subject string) error {
+	repo := repository.New(s.pool)
+	params := repository.ClearLoginFailuresParams{
+		Kind:    kind,
+		Subject: subject,
+	}
+	cleared, err := repo.ClearLoginFailures(ctx, params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if cleared == 0 {
+		return ErrNoLoginFailures
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"auth-strategies/internal/mail"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/url"
+	"time"
+)
+
+const magicLinkLifetime = 15 * time.Minute
+
+// Paths magic links point to, depending on the login mode they were requested for
+const (
+	magicLinkSessionPath = "/auth/magic-link/login"
+	magicLinkTokenPath   = "/auth/token/magic-link/login"
+)
+
+var (
+	errMagicLinkInvalid = errors.New("invalid magic link")
+)
+
+type magicLinkRq struct {
+	email string
+	mode  string
+	// firstName and lastName are only used if an account is created for the email address
+	firstName string
+	lastName  string
+}
+
+// requestMagicLink mail a single-use login link to the email address. Unknown addresses are sent a link too if
+// self-registration is enabled, their account being created once the link is used, and are silently ignored
+// otherwise, so that the response doesn't reveal which addresses are registered.
+func (s *Service) requestMagicLink(ctx context.Context, rq *magicLinkRq) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	var token string
+	userId, err := repo.FindUserIdByEmail(ctx, rq.email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !s.cfg.MagicLink.SelfRegistration {
+			return nil
+		}
+		token, err = createMagicLinkSignup(ctx, repo, rq)
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	} else {
+		token, err = createOneTimeToken(ctx, repo, userId, tokenPurposeMagicLink, magicLinkLifetime)
+	}
+	if err != nil {
+		return err
+	}
+
+	path := magicLinkSessionPath
+	if rq.mode == loginModeToken {
+		path = magicLinkTokenPath
+	}
+	link := s.cfg.Server.PublicUrl + path + "?" + url.Values{"token": {token}}.Encode()
+
+	data := mail.LinkData{Link: link, ValidFor: magicLinkLifetime}
+	if err := enqueueMail(ctx, repo, rq.email, mail.TemplateMagicLink, data); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
+
+// createMagicLinkSignup issue the token of a magic link for an unknown email address, replacing any previous one.
+// Only the hash of the token is stored, along with the name to create the account with.
+func createMagicLinkSignup(ctx context.Context, repo *repository.Queries, rq *magicLinkRq) (string, error) {
+	// Expired signups are never looked up again, so they are cleaned up opportunistically
+	if err := repo.DeleteExpiredMagicLinkSignups(ctx); err != nil {
+		return "", fmt.Errorf("failed to delete expired magic link signups: %w", err)
+	}
+	if err := repo.DeleteMagicLinkSignups(ctx, rq.email); err != nil {
+		return "", fmt.Errorf("failed to delete magic link signups: %w", err)
+	}
+
+	token, err := generateRandomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	params := repository.CreateMagicLinkSignupParams{
+		Email:     rq.email,
+		FirstName: rq.firstName,
+		LastName:  rq.lastName,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(magicLinkLifetime),
+	}
+	if err := repo.CreateMagicLinkSignup(ctx, params); err != nil {
+		return "", fmt.Errorf("failed to create magic link signup: %w", err)
+	}
+	return token, nil
+}
+
+// magicLinkLogin consume the token of a magic link, return the id of the user it was sent to. Links sent to unknown
+// addresses under self-registration create the account here. The email address is verified along the way, the link
+// having been delivered there.
+func (s *Service) magicLinkLogin(ctx context.Context, token string) (*uuid.UUID, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	userId, err := consumeOneTimeToken(ctx, repo, tokenPurposeMagicLink, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		userId, err = consumeMagicLinkSignup(ctx, repo, token)
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errMagicLinkInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The password of an unverified account may have been set by anyone who registered the address before its owner,
+	// waiting for them to verify it. Only the link proves access to the address, so the password doesn't survive it.
+	if err := repo.DeleteUnverifiedPasswordAuth(ctx, userId); err != nil {
+		return nil, fmt.Errorf("failed to delete password of unverified user: %w", err)
+	}
+	if err := repo.MarkEmailVerified(ctx, userId); err != nil {
+		return nil, fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return &userId, nil
+}
+
+// consumeMagicLinkSignup burn the token of a magic link sent to an unknown address, and create the account of the
+// address. The account has no password. Return sql.ErrNoRows for unknown, expired or already used tokens.
+func consumeMagicLinkSignup(ctx context.Context, repo *repository.Queries, token string) (uuid.UUID, error) {
+	signup, err := repo.ConsumeMagicLinkSignup(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, err
+	} else if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	// The address may have registered in the meantime, the link still proves access to it
+	userId, err := repo.FindUserIdByEmail(ctx, signup.Email)
+	if err == nil {
+		return userId, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	params := repository.CreateUserParams{
+		Email:     signup.Email,
+		FirstName: signup.FirstName,
+		LastName:  signup.LastName,
+	}
+	userId, err = repo.CreateUser(ctx, params)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed creating user: %w", err)
+	}
+	return userId, nil
+}
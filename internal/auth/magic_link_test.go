@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+// TestMagicLinkPreAccountHijacking an attacker registers the address of the victim with a password of their own, and
+// waits for the victim to verify it by logging in with a magic link. The password of the attacker must not work on the
+// verified account, while the password of an account that was already verified stays.
+func TestMagicLinkPreAccountHijacking(t *testing.T) {
+	pool := testPool(t)
+	api := sessionTestApi(t, pool)
+	ctx := context.Background()
+	repo := repository.New(pool)
+
+	useMagicLink := func(t *testing.T, userId uuid.UUID) {
+		token, err := createOneTimeToken(ctx, repo, userId, tokenPurposeMagicLink, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.s.magicLinkLogin(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("unverified account", func(t *testing.T) {
+		userId, email := testPasswordUser(t, api)
+		useMagicLink(t, userId)
+
+		_, err := api.s.checkPassword(ctx, email, sessionTestPassword, "192.0.2.1")
+		if !errors.Is(err, errInvalidCredentials) {
+			t.Fatalf("password of the unverified account kept: %v", err)
+		}
+	})
+
+	t.Run("verified account", func(t *testing.T) {
+		userId, email := testPasswordUser(t, api)
+		if err := repo.MarkEmailVerified(ctx, userId); err != nil {
+			t.Fatal(err)
+		}
+		useMagicLink(t, userId)
+
+		if _, err := api.s.checkPassword(ctx, email, sessionTestPassword, "192.0.2.1"); err != nil {
+			t.Fatalf("password of the verified account lost: %v", err)
+		}
+	})
+}
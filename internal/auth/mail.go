@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"auth-strategies/internal/mail"
+	"context"
+	"fmt"
+)
+
+// enqueueMail mail the user, via the outbox in the transaction of repo
+func enqueueMail(ctx context.Context, repo *repository.Queries, email string, template string, data any) error {
+	msg, err := mail.Render(template, email, data)
+	if err != nil {
+		return fmt.Errorf("failed to render %s mail: %w", template, err)
+	}
+	if err := mail.Enqueue(ctx, repo, msg); err != nil {
+		return fmt.Errorf("failed to enqueue %s mail: %w", template, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	mfaChallengeLifetime = 5 * time.Minute
+	// mfaChallengeMaxAttempts is how many wrong codes a challenge tolerates before it is discarded, forcing the client
+	// to start over with the password
+	mfaChallengeMaxAttempts = 5
+)
+
+// Ways of completing a login, an MFA challenge remembers which one the password was submitted for
+const (
+	loginModeSession = "session"
+	loginModeToken   = "token"
+)
+
+var (
+	errMfaChallengeInvalid = errors.New("invalid mfa challenge")
+	errInvalidMfaCode      = errors.New("invalid mfa code")
+	errMfaCsrf             = errors.New("csrf token required to complete a session login")
+)
+
+// mfaEnabled whether the user has to provide a second factor on login
+func (s *Service) mfaEnabled(ctx context.Context, userId *uuid.UUID) (bool, error) {
+	repo := repository.New(s.pool)
+	enabled, err := repo.MfaEnabled(ctx, *userId)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errDb, err)
+	}
+	return enabled, nil
+}
+
+// createMfaChallenge issue a short-lived challenge for a user who passed the first factor. The login is completed by
+// presenting it along with a second factor to verifyMfaChallenge.
+func (s *Service) createMfaChallenge(ctx context.Context, userId *uuid.UUID, mode string) (string, error) {
+	repo := repository.New(s.pool)
+
+	// Expired challenges are never looked up again, so they are cleaned up opportunistically
+	if err := repo.DeleteExpiredMfaChallenges(ctx); err != nil {
+		return "", fmt.Errorf("failed to delete expired mfa challenges: %w", err)
+	}
+
+	challenge, err := generateRandomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	params := repository.CreateMfaChallengeParams{
+		UserID:    *userId,
+		TokenHash: hashToken(challenge),
+		Mode:      mode,
+		ExpiresAt: time.Now().Add(mfaChallengeLifetime),
+	}
+	if err := repo.CreateMfaChallenge(ctx, params); err != nil {
+		return "", fmt.Errorf("failed to create mfa challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// verifyMfaChallenge check the second factor of a pending login, either a TOTP code or a recovery code. A challenge
+// can only complete a single login. Challenges of session logins are left untouched unless csrfVerified, i.e. the
+// request carried the CSRF token of its session, see CsrfLogin.
+// Return the id of the user and the login mode the challenge was issued for.
+func (s *Service) verifyMfaChallenge(ctx context.Context, rawChallenge, code string, csrfVerified bool) (*uuid.UUID, string, error) {
+	challengeHash := hashToken(rawChallenge)
+
+	var recoveryHashes map[string][]byte
+	if len(code) != totpDigits {
+		var err error
+		recoveryHashes, err = s.hashRecoveryCode(ctx, challengeHash, code)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	challenge, err := repo.FindMfaChallengeForUpdate(ctx, challengeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", fmt.Errorf("%w: mfa challenge not found", errMfaChallengeInvalid)
+	} else if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", errDb, err)
+	}
+	if !time.Now().Before(challenge.ExpiresAt) {
+		return nil, "", fmt.Errorf("%w: mfa challenge expired", errMfaChallengeInvalid)
+	}
+	if challenge.Mode == loginModeSession && !csrfVerified {
+		return nil, "", errMfaCsrf
+	}
+
+	if err := checkMfaLockout(ctx, repo, challenge.UserID); err != nil {
+		return nil, "", err
+	}
+
+	var valid bool
+	if len(code) == totpDigits {
+		valid, err = verifyTotp(ctx, repo, challenge.UserID, code)
+	} else {
+		valid, err = useRecoveryCode(ctx, repo, challenge.UserID, recoveryHashes)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !valid {
+		if challenge.Attempts+1 >= mfaChallengeMaxAttempts {
+			err = repo.DeleteMfaChallenge(ctx, challenge.ID)
+		} else {
+			err = repo.IncrementMfaChallengeAttempts(ctx, challenge.ID)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to record failed mfa attempt: %w", err)
+		}
+		if err := s.recordMfaFailure(ctx, repo, challenge.UserID); err != nil {
+			return nil, "", err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, "", fmt.Errorf("transaction commit failed: %w", err)
+		}
+		return nil, "", errInvalidMfaCode
+	}
+
+	if err := repo.DeleteMfaChallenge(ctx, challenge.ID); err != nil {
+		return nil, "", fmt.Errorf("failed to delete mfa challenge: %w", err)
+	}
+	if err := clearMfaFailures(ctx, repo, challenge.UserID); err != nil {
+		return nil, "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, "", fmt.Errorf("transaction commit failed: %w", err)
+	}
+
+	return &challenge.UserID, challenge.Mode, nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Purposes of one-time tokens, a token is only accepted for the purpose it was issued for
+const (
+	tokenPurposePasswordReset     = "password_reset"
+	tokenPurposeEmailVerification = "email_verification"
+	tokenPurposeMagicLink         = "magic_link"
+)
+
+// createOneTimeToken issue a single-use token for the user, replacing any previous token issued for the same purpose.
+// Only the hash of the token is stored.
+func createOneTimeToken(ctx context.Context, repo *repository.Queries, userId uuid.UUID, purpose string, lifetime time.Duration) (string, error) {
+	// Expired tokens are never looked up again, so they are cleaned up opportunistically
+	if err := repo.DeleteExpiredOneTimeTokens(ctx); err != nil {
+		return "", fmt.Errorf("failed to delete expired one-time tokens: %w", err)
+	}
+
+	deleteParams := repository.DeleteOneTimeTokensParams{
+		UserID:  userId,
+		Purpose: purpose,
+	}
+	if err := repo.DeleteOneTimeTokens(ctx, deleteParams); err != nil {
+		return "", fmt.Errorf("failed to delete one-time tokens: %w", err)
+	}
+
+	token, err := generateRandomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	params := repository.CreateOneTimeTokenParams{
+		UserID:    userId,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	if err := repo.CreateOneTimeToken(ctx, params); err != nil {
+		return "", fmt.Errorf("failed to create one-time token: %w", err)
+	}
+
+	return token, nil
+}
+
+// consumeOneTimeToken burn an unexpired token issued for purpose, return the id of the user it was issued to.
+// Return sql.ErrNoRows for unknown, expired or already used tokens.
+func consumeOneTimeToken(ctx context.Context, repo *repository.Queries, purpose string, token string) (uuid.UUID, error) {
+	params := repository.ConsumeOneTimeTokenParams{
+		TokenHash: hashToken(token),
+		Purpose:   purpose,
+	}
+	return repo.ConsumeOneTimeToken(ctx, params)
+}
+
+// findOneTimeToken look up an unexpired token issued for purpose without burning it, return the id of the user it was
+// issued to. Return sql.ErrNoRows for unknown, expired or already used tokens.
+func findOneTimeToken(ctx context.Context, repo *repository.Queries, purpose string, token string) (uuid.UUID, error) {
+	params := repository.FindOneTimeTokenParams{
+		TokenHash: hashToken(token),
+		Purpose:   purpose,
+	}
+	return repo.FindOneTimeToken(ctx, params)
+}
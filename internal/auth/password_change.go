@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+var (
+	errNoPassword = errors.New("user has no password")
+)
+
+type changePasswordRq struct {
+	userId          uuid.UUID
+	currentPassword string
+	newPassword     string
+	// revokeOthers revoke the other sessions, API keys, refresh and access tokens of the user as well
+	revokeOthers bool
+	// sessionId the session the password is changed in, kept when revoking the others
+	sessionId uuid.UUID
+	// ip the address the request came from, counted like a login when the current password is wrong
+	ip string
+}
+
+// changePassword replace the password of a user who knows the current one. MFA challenges issued for the old password
+// are discarded. Users without a password, e.g. those registered via magic link, have to set one via password reset.
+// A wrong current password counts as a failed login, and a *lockoutError is returned while the email address or the IP
+// address is locked out, so that a stolen session can't be used to guess the password.
+func (s *Service) changePassword(ctx context.Context, rq *changePasswordRq) error {
+	repo := repository.New(s.pool)
+	current, err := repo.GetPasswordHash(ctx, rq.userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errNoPassword
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	user, err := repo.GetUserAccount(ctx, rq.userId)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if err := checkLoginLockout(ctx, repo, user.Email, rq.ip); err != nil {
+		return err
+	}
+
+	newPassword := s.policy.normalizePassword(rq.newPassword)
+	if err := s.policy.check(newPassword, user.Email, user.FirstName, user.LastName); err != nil {
+		return err
+	}
+
+	// Verified and hashed before the transaction is started, so that no connection is held while waiting for the hasher
+	valid, _, err := s.verifyPassword(ctx, rq.currentPassword, current.PwHash, current.PwNormalized)
+	if err != nil {
+		return err
+	} else if !valid {
+		if err := s.recordLoginFailure(ctx, repo, user.Email, rq.ip); err != nil {
+			return err
+		}
+		return errInvalidCredentials
+	}
+	if err := clearLoginFailures(ctx, repo, user.Email); err != nil {
+		return err
+	}
+
+	newHash, err := s.hasher.hashPassword(ctx, newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo = repository.New(tx)
+
+	// Only replaced if it is still the hash the current password was verified against
+	params := repository.ReplacePasswordHashParams{
+		NewHash:      newHash,
+		PwNormalized: s.policy.normalize,
+		UserID:       rq.userId,
+		OldHash:      current.PwHash,
+	}
+	replaced, err := repo.ReplacePasswordHash(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to replace password hash: %w", err)
+	}
+	if replaced == 0 {
+		return fmt.Errorf("%w: password changed concurrently", errInvalidCredentials)
+	}
+
+	if err := repo.DeleteMfaChallenges(ctx, rq.userId); err != nil {
+		return fmt.Errorf("failed to delete mfa challenges: %w", err)
+	}
+
+	var cutoff tokenCutoff
+	if rq.revokeOthers {
+		if cutoff, err = revokeUserCredentials(ctx, repo, rq.userId, rq.sessionId); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	if rq.revokeOthers {
+		s.revoked.addCutoff(rq.userId, cutoff)
+	}
+	return nil
+}
+
+// revokeUserCredentials revoke every session but keepSession (uuid.Nil keeps none), API key, refresh token and access
+// token of the user
+func revokeUserCredentials(ctx context.Context, repo *repository.Queries, userId, keepSession uuid.UUID) (tokenCutoff, error) {
+	params := repository.DeleteOtherUserSessionsParams{
+		UserID: userId,
+		ID:     keepSession,
+	}
+	if err := repo.DeleteOtherUserSessions(ctx, params); err != nil {
+		return tokenCutoff{}, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	if err := repo.RevokeAllApiKeys(ctx, userId); err != nil {
+		return tokenCutoff{}, fmt.Errorf("failed to revoke api keys: %w", err)
+	}
+	if err := repo.RevokeAllRefreshTokens(ctx, userId); err != nil {
+		return tokenCutoff{}, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return cutOffAccessTokens(ctx, repo, userId)
+}
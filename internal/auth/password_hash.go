@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"auth-strategies/internal/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+var (
+	errInvalidPasswordHash = errors.New("invalid password hash")
+	// ErrUnsupportedPasswordHash the hash is of an algorithm no passwordHasher is registered for
+	ErrUnsupportedPasswordHash = errors.New("unsupported password hash algorithm")
+)
+
+// passwordHasher verifies the hashes of one algorithm. Hashes are strings in the PHC string format, or the modular
+// crypt format it grew out of, so that the algorithm can be told from the identifier between the first two $.
+type passwordHasher interface {
+	// verify check password against a hash of the algorithm
+	verify(password, encoded string) (bool, error)
+	// validate check that a hash of the algorithm is well-formed, without verifying a password against it
+	validate(encoded string) error
+}
+
+// argon2idAlgorithm is the algorithm new passwords are hashed with, hashes of any other algorithm are replaced on the
+// next login of their user
+const argon2idAlgorithm = "argon2id"
+
+// passwordHashers every supported algorithm by identifier. Besides argon2id, these are hashes imported from legacy
+// systems, see legacy_hash.go.
+var passwordHashers = map[string]passwordHasher{
+	argon2idAlgorithm: argon2idHasher{},
+	"2a":              bcryptHasher{},
+	"2b":              bcryptHasher{},
+	"2y":              bcryptHasher{},
+	"pbkdf2-sha256":   pbkdf2Sha256Hasher{},
+	"scrypt":          scryptHasher{},
+}
+
+// lookupPasswordHasher find the passwordHasher of the algorithm encoded was hashed with, return its identifier too
+func lookupPasswordHasher(encoded string) (string, passwordHasher, error) {
+	parts := strings.SplitN(encoded, "$", 3)
+	if len(parts) != 3 || parts[0] != "" {
+		return "", nil, fmt.Errorf("%w: not in PHC string format", errInvalidPasswordHash)
+	}
+	hasher, ok := passwordHashers[parts[1]]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %q", ErrUnsupportedPasswordHash, parts[1])
+	}
+	return parts[1], hasher, nil
+}
+
+// ValidatePasswordHash check that encoded is a well-formed hash of a supported algorithm
+func ValidatePasswordHash(encoded string) error {
+	_, hasher, err := lookupPasswordHasher(encoded)
+	if err != nil {
+		return err
+	}
+	return hasher.validate(encoded)
+}
+
+// argon2Params the parameters of an argon2id hash, stored along with it
+type argon2Params struct {
+	time      uint32
+	memory    uint32
+	threads   uint8
+	keyLength uint32
+	// saltLength is only used for new hashes, decoded hashes have a salt of their own
+	saltLength uint32
+}
+
+func newArgon2Params(cfg *config.Argon2Config) (argon2Params, error) {
+	p := argon2Params{
+		time:       cfg.Time,
+		memory:     cfg.Memory,
+		threads:    cfg.Threads,
+		keyLength:  cfg.KeyLength,
+		saltLength: cfg.SaltLength,
+	}
+	// Minimums recommended by RFC 9106 for salts and tags
+	if p.time < 1 || p.threads < 1 || p.memory < 8*uint32(p.threads) || p.keyLength < 16 || p.saltLength < 16 {
+		return argon2Params{}, fmt.Errorf("invalid argon2 parameters: %+v", *cfg)
+	}
+	return p, nil
+}
+
+// phcEncoding is the unpadded base64 of the PHC string format
+var phcEncoding = base64.RawStdEncoding
+
+// hashPassword compute the argon2id hash of password with a new random salt, encoded in the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func hashPassword(password string, p argon2Params) (string, error) {
+	salt := make([]byte, p.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed generating salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLength)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		p.memory,
+		p.time,
+		p.threads,
+		phcEncoding.EncodeToString(salt),
+		phcEncoding.EncodeToString(key),
+	), nil
+}
+
+// verifyPassword check password against a hash of any supported algorithm. Also return whether the hash should be
+// replaced, because it is of another algorithm than argon2id or was computed with parameters other than p.
+func verifyPassword(password, encoded string, p argon2Params) (bool, bool, error) {
+	algorithm, hasher, err := lookupPasswordHasher(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	valid, err := hasher.verify(password, encoded)
+	if err != nil || !valid {
+		return false, false, err
+	}
+	if algorithm != argon2idAlgorithm {
+		return true, true, nil
+	}
+
+	hashParams, salt, _, err := decodeArgon2idHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	outdated := hashParams.time != p.time ||
+		hashParams.memory != p.memory ||
+		hashParams.threads != p.threads ||
+		hashParams.keyLength != p.keyLength ||
+		uint32(len(salt)) != p.saltLength
+	return true, outdated, nil
+}
+
+type argon2idHasher struct{}
+
+func (argon2idHasher) verify(password, encoded string) (bool, error) {
+	p, salt, key, err := decodeArgon2idHash(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLength)
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (argon2idHasher) validate(encoded string) error {
+	_, _, _, err := decodeArgon2idHash(encoded)
+	return err
+}
+
+func decodeArgon2idHash(encoded string) (argon2Params, []byte, []byte, error) {
+	// The leading $ yields an empty first part
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: not in PHC string format", errInvalidPasswordHash)
+	}
+	if parts[1] != argon2idAlgorithm {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: unsupported algorithm %q", errInvalidPasswordHash, parts[1])
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: unsupported version %q", errInvalidPasswordHash, parts[2])
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: invalid parameters: %w", errInvalidPasswordHash, err)
+	}
+	// argon2 panics on these
+	if p.time < 1 || p.threads < 1 {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: invalid parameters %q", errInvalidPasswordHash, parts[3])
+	}
+
+	salt, err := phcEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: invalid salt: %w", errInvalidPasswordHash, err)
+	}
+	key, err := phcEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: invalid hash: %w", errInvalidPasswordHash, err)
+	}
+	if len(key) == 0 {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: empty hash", errInvalidPasswordHash)
+	}
+	p.keyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
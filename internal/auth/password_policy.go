@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"auth-strategies/internal/config"
+	"context"
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minContextWordLength is the length from which parts of the name and email address of a user are banned from their
+// password, shorter ones would rule out too many passwords for no gain
+const minContextWordLength = 3
+
+// passwordPolicyError a new password rejected by the policy, the reason is safe to show to the user
+type passwordPolicyError struct {
+	reason string
+}
+
+func (e *passwordPolicyError) Error() string {
+	return "password rejected by policy: " + e.reason
+}
+
+// passwordPolicy the requirements on new passwords, see config.PasswordConfig
+type passwordPolicy struct {
+	minLength   int
+	maxLength   int
+	normalize   bool
+	bannedWords []string
+	// breached is nil if the check is disabled
+	breached *breachedPasswords
+}
+
+func newPasswordPolicy(cfg *config.PasswordConfig) (*passwordPolicy, error) {
+	if cfg.MinLength < 1 || cfg.MaxLength < cfg.MinLength {
+		return nil, fmt.Errorf("invalid password length bounds %d-%d", cfg.MinLength, cfg.MaxLength)
+	}
+
+	p := &passwordPolicy{
+		minLength: cfg.MinLength,
+		maxLength: cfg.MaxLength,
+		normalize: cfg.Normalize,
+	}
+	for _, word := range cfg.BannedWords {
+		p.bannedWords = append(p.bannedWords, strings.ToLower(p.normalizePassword(word)))
+	}
+
+	if cfg.BreachedPasswordsFile != "" {
+		breached, err := loadBreachedPasswords(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+		p.breached = breached
+	}
+	return p, nil
+}
+
+// normalizePassword the form of a password that is hashed and checked against the policy
+func (p *passwordPolicy) normalizePassword(password string) string {
+	if !p.normalize {
+		return password
+	}
+	return norm.NFKC.String(password)
+}
+
+// check make sure a new, normalized password is acceptable. userWords describe the user, e.g. their name and email
+// address, no word of them may appear in the password.
+func (p *passwordPolicy) check(password string, userWords ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return &passwordPolicyError{fmt.Sprintf("Password must be at least %d characters long", p.minLength)}
+	}
+	if length > p.maxLength {
+		return &passwordPolicyError{fmt.Sprintf("Password must be at most %d characters long", p.maxLength)}
+	}
+
+	lower := strings.ToLower(password)
+	for _, word := range p.bannedWords {
+		if strings.Contains(lower, word) {
+			return &passwordPolicyError{"Password must not contain " + word}
+		}
+	}
+	for _, word := range contextWords(userWords...) {
+		if strings.Contains(lower, strings.ToLower(p.normalizePassword(word))) {
+			return &passwordPolicyError{"Password must not contain your name or email address"}
+		}
+	}
+
+	if p.breached != nil && p.breached.contains(password) {
+		return &passwordPolicyError{"Password is known from a data breach, choose another one"}
+	}
+	return nil
+}
+
+// contextWords split the name and email address of a user into the words that are banned from their password. Of the
+// email address, the top-level domain is left out.
+func contextWords(userWords ...string) []string {
+	var words []string
+	for _, s := range userWords {
+		if local, domain, ok := strings.Cut(s, "@"); ok {
+			if i := strings.LastIndex(domain, "."); i >= 0 {
+				domain = domain[:i]
+			}
+			s = local + " " + domain
+		}
+
+		fields := strings.FieldsFunc(s, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, field := range fields {
+			if utf8.RuneCountInString(field) >= minContextWordLength {
+				words = append(words, field)
+			}
+		}
+	}
+	return words
+}
+
+// verifyPassword check a password against the stored hash, normalizing it first if the hash is of the normalized
+// password. Hashes stored the other way than normalize is currently set, e.g. imported ones or ones set before it was
+// enabled, are reported outdated, so that they are replaced.
+func (s *Service) verifyPassword(ctx context.Context, password, encoded string, normalized bool) (bool, bool, error) {
+	if normalized {
+		password = norm.NFKC.String(password)
+	}
+	valid, outdated, err := s.hasher.verifyPassword(ctx, password, encoded)
+	return valid, outdated || normalized != s.policy.normalize, err
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"auth-strategies/internal/mail"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const passwordResetTokenLifetime = 30 * time.Minute
+
+var (
+	errResetTokenInvalid = errors.New("invalid password reset token")
+)
+
+// requestPasswordReset send a password reset token to the user with the given email address. Unknown addresses are
+// silently ignored, so that the response doesn't reveal which addresses are registered.
+func (s *Service) requestPasswordReset(ctx context.Context, email string) error {
+	repo := repository.New(s.pool)
+
+	userId, err := repo.FindUserIdByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	token, err := createOneTimeToken(ctx, repo, userId, tokenPurposePasswordReset, passwordResetTokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	data := mail.TokenData{Token: token, ValidFor: passwordResetTokenLifetime}
+	return enqueueMail(ctx, repo, email, mail.TemplatePasswordReset, data)
+}
+
+type resetPasswordRq struct {
+	token    string
+	password string
+	// revokeAll revoke the sessions, API keys, refresh and access tokens of the user as well, in case the account was
+	// compromised
+	revokeAll bool
+}
+
+// resetPassword set a new password for the user the reset token was issued to, and mark their email address verified.
+// MFA challenges issued for the old password are discarded.
+func (s *Service) resetPassword(ctx context.Context, rq *resetPasswordRq) error {
+	// The token is only looked up here to check the password against the user it was issued to, it's consumed in the
+	// transaction below
+	repo := repository.New(s.pool)
+	userId, err := findOneTimeToken(ctx, repo, tokenPurposePasswordReset, rq.token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errResetTokenInvalid
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	user, err := repo.GetUserAccount(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	password := s.policy.normalizePassword(rq.password)
+	if err := s.policy.check(password, user.Email, user.FirstName, user.LastName); err != nil {
+		return err
+	}
+
+	// Hashed before the transaction is started, so that no connection is held while waiting for the hasher
+	pwHash, err := s.hasher.hashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo = repository.New(tx)
+
+	userId, err = consumeOneTimeToken(ctx, repo, tokenPurposePasswordReset, rq.token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errResetTokenInvalid
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	params := repository.SetPasswordAuthParams{
+		UserID:       userId,
+		PwHash:       pwHash,
+		PwNormalized: s.policy.normalize,
+	}
+	if err := repo.SetPasswordAuth(ctx, params); err != nil {
+		return fmt.Errorf("failed to set password auth: %w", err)
+	}
+
+	// The token was delivered to the email address, which proves the user controls it
+	if err := repo.MarkEmailVerified(ctx, userId); err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	if err := repo.DeleteMfaChallenges(ctx, userId); err != nil {
+		return fmt.Errorf("failed to delete mfa challenges: %w", err)
+	}
+
+	var cutoff tokenCutoff
+	if rq.revokeAll {
+		if cutoff, err = revokeUserCredentials(ctx, repo, userId, uuid.Nil); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	if rq.revokeAll {
+		s.revoked.addCutoff(userId, cutoff)
+	}
+
+	return nil
+}
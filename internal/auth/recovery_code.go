@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets, each of them can replace the second factor once
+const recoveryCodeCount = 10
+
+var (
+	errMfaNotEnabled = errors.New("mfa not enabled")
+)
+
+// recoveryCodeSet a freshly generated set of recovery codes, in plain text for the user and hashed for storage
+type recoveryCodeSet struct {
+	codes  []string
+	salt   []byte
+	hashes [][]byte
+}
+
+// generateRecoveryCodes generate and hash a new set of recovery codes. Hashing is slow, so it is done before any
+// transaction is started, and only the digests are stored by storeRecoveryCodes.
+//
+// Codes are hashed like passwords, but the whole set shares a salt: checking a code against the set then takes a
+// single argon2 computation, instead of one for every remaining code.
+func generateRecoveryCodes(ctx context.Context, h *hasher) (*recoveryCodeSet, error) {
+	salt, err := generateSalt()
+	if err != nil {
+		return nil, fmt.Errorf("failed generating salt: %w", err)
+	}
+
+	set := &recoveryCodeSet{
+		codes:  make([]string, 0, recoveryCodeCount),
+		salt:   salt,
+		hashes: make([][]byte, 0, recoveryCodeCount),
+	}
+	for range recoveryCodeCount {
+		code, err := generateRandomHex(5)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, err := h.hash(ctx, code, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		// Grouped for readability, the dash is not part of the code
+		set.codes = append(set.codes, code[:5]+"-"+code[5:])
+		set.hashes = append(set.hashes, hash)
+	}
+	return set, nil
+}
+
+// storeRecoveryCodes replace the recovery codes of the user with the given set
+func storeRecoveryCodes(ctx context.Context, repo *repository.Queries, userId uuid.UUID, set *recoveryCodeSet) error {
+	if err := repo.DeleteRecoveryCodes(ctx, userId); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range set.hashes {
+		params := repository.CreateRecoveryCodeParams{
+			UserID:   userId,
+			CodeHash: hash,
+			CodeSalt: set.salt,
+		}
+		if err := repo.CreateRecoveryCode(ctx, params); err != nil {
+			return fmt.Errorf("failed to create recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// regenerateRecoveryCodes replace the recovery codes of a user with a second factor, invalidating the previous ones
+func (s *Service) regenerateRecoveryCodes(ctx context.Context, userId *uuid.UUID) ([]string, error) {
+	recoveryCodes, err := generateRecoveryCodes(ctx, s.hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	enabled, err := repo.MfaEnabled(ctx, *userId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+	if !enabled {
+		return nil, errMfaNotEnabled
+	}
+
+	if err := storeRecoveryCodes(ctx, repo, *userId, recoveryCodes); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return recoveryCodes.codes, nil
+}
+
+// hashRecoveryCode hash a recovery code submitted for an MFA challenge with the salt of every unused recovery code of
+// the user the challenge was issued for, keyed by the salt. Hashing is slow, so it is done before the transaction that
+// verifies the challenge is started, and useRecoveryCode then only compares digests. No hashing is done for unknown
+// challenges or users locked out of MFA, the transaction reports them.
+func (s *Service) hashRecoveryCode(ctx context.Context, challengeHash []byte, code string) (map[string][]byte, error) {
+	repo := repository.New(s.pool)
+
+	userId, err := repo.FindMfaChallengeUser(ctx, challengeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+	if err := checkMfaLockout(ctx, repo, userId); err != nil {
+		var lockout *lockoutError
+		if errors.As(err, &lockout) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	salts, err := repo.ListUnusedRecoveryCodeSalts(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hashes := make(map[string][]byte, len(salts))
+	for _, salt := range salts {
+		hash, err := s.hasher.hash(ctx, code, salt)
+		if err != nil {
+			return nil, err
+		}
+		hashes[string(salt)] = hash
+	}
+	return hashes, nil
+}
+
+// useRecoveryCode check the hashes of a code computed by hashRecoveryCode against the unused recovery codes of the
+// user, and burn the code if it matches. Codes whose salt has no hash, i.e. codes regenerated meanwhile, never match.
+func useRecoveryCode(ctx context.Context, repo *repository.Queries, userId uuid.UUID, hashes map[string][]byte) (bool, error) {
+	rows, err := repo.ListUnusedRecoveryCodesForUpdate(ctx, userId)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	for _, row := range rows {
+		hash, ok := hashes[string(row.CodeSalt)]
+		if !ok || subtle.ConstantTimeCompare(hash, row.CodeHash) != 1 {
+			continue
+		}
+
+		if err := repo.MarkRecoveryCodeUsed(ctx, row.ID); err != nil {
+			return false, fmt.Errorf("failed to mark recovery code used: %w", err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
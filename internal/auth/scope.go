@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"auth-strategies/internal/common"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Scopes API keys can be issued with
+const (
+	ScopeUserRead     = "user:read"
+	ScopeApiKeyRotate = "api-key:rotate"
+)
+
+var knownScopes = []string{ScopeUserRead, ScopeApiKeyRotate}
+
+var (
+	errScopesMissing = errors.New("at least one scope is required")
+	errUnknownScope  = errors.New("unknown scope")
+)
+
+// validateScopes check that scopes is a non-empty list of known scopes, return it without duplicates
+func validateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errScopesMissing
+	}
+
+	var unique []string
+	for _, scope := range scopes {
+		if !slices.Contains(knownScopes, scope) {
+			return nil, fmt.Errorf("%w: %s", errUnknownScope, scope)
+		}
+		if !slices.Contains(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+	return unique, nil
+}
+
+// RequireScope reject requests authenticated by an API key that was not issued with the given scope. Requests
+// authenticated by other strategies carry the full identity of the user, so they are let through. Must be placed
+// after the authentication middleware in the chain.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, ok := r.Context().Value("scopes").([]string)
+			if ok && !slices.Contains(scopes, scope) {
+				common.WriteJSON(w, http.StatusForbidden, common.ErrorResponse{Error: "Missing scope " + scope})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
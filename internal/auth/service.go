@@ -1,24 +1,91 @@
 package auth
 
 import (
+	"auth-strategies/internal/config"
 	"auth-strategies/internal/db/repository"
+	"auth-strategies/internal/mail"
 	"bytes"
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"time"
 )
 
 type Service struct {
-	pool *pgxpool.Pool
+	pool     *pgxpool.Pool
+	keys     *keyRing
+	revoked  *denylist
+	webauthn *webauthn.WebAuthn
+	hasher   *hasher
+	policy   *passwordPolicy
+	cfg      *config.Config
 }
 
-func NewService(pool *pgxpool.Pool) *Service {
-	return &Service{pool}
+func NewService(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config) (*Service, error) {
+	key, err := loadSigningKey(cfg.Token.PrivateKeyFile, cfg.Token.KeyId, []byte(cfg.Server.HmacSecret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token signing key: %w", err)
+	}
+
+	keys := newKeyRing(key)
+	if err := keys.load(ctx, repository.New(pool)); err != nil {
+		return nil, fmt.Errorf("failed to load key ring: %w", err)
+	}
+
+	revoked := newDenylist()
+	if err := revoked.sync(ctx, repository.New(pool)); err != nil {
+		return nil, fmt.Errorf("failed to load revoked tokens: %w", err)
+	}
+
+	wa, err := newWebauthn(&cfg.Webauthn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn config: %w", err)
+	}
+
+	h, err := newHasher(&cfg.Hashing)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hashing config: %w", err)
+	}
+
+	policy, err := newPasswordPolicy(&cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password config: %w", err)
+	}
+
+	return &Service{pool, keys, revoked, wa, h, policy, cfg}, nil
+}
+
+// Run periodically reload state shared between server instances, until ctx is cancelled
+func (s *Service) Run(ctx context.Context) {
+	keyTicker := time.NewTicker(s.cfg.Token.KeyRefreshInterval)
+	defer keyTicker.Stop()
+	revocationTicker := time.NewTicker(s.cfg.Token.RevocationSyncInterval)
+	defer revocationTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keyTicker.C:
+			if err := s.keys.load(ctx, repository.New(s.pool)); err != nil {
+				log.Error().Err(err).Msg("failed to reload signing keys")
+			}
+		case <-revocationTicker.C:
+			if err := s.revoked.sync(ctx, repository.New(s.pool)); err != nil {
+				log.Error().Err(err).Msg("failed to sync revoked tokens")
+			}
+		}
+	}
 }
 
 var (
@@ -26,24 +93,76 @@ var (
 	errInvalidCredentials = errors.New("invalid credentials")
 )
 
-func (s *Service) checkPassword(ctx context.Context, email, password string) (*uuid.UUID, error) {
+// checkPassword verify the password of the user with the given email address, return their id. Failed attempts are
+// counted per email address and per IP address, a *lockoutError is returned without checking the password while either
+// of them is locked out.
+func (s *Service) checkPassword(ctx context.Context, email, password, ip string) (*uuid.UUID, error) {
 	repo := repository.New(s.pool)
+	if err := checkLoginLockout(ctx, repo, email, ip); err != nil {
+		return nil, err
+	}
+
 	authInfo, err := repo.GetPasswordAuth(ctx, email)
 	if errors.Is(err, sql.ErrNoRows) {
 		// Differentiate unknown email address from db error
+		if err := s.recordLoginFailure(ctx, repo, email, ip); err != nil {
+			return nil, err
+		}
 		return nil, errInvalidCredentials
 	} else if err != nil {
 		return nil, fmt.Errorf("%w: %w", errDb, err)
 	}
 
-	inputPWHash := computeHash(password, authInfo.PwSalt)
-	if !bytes.Equal(inputPWHash, authInfo.PwHash) {
+	valid, outdated, err := s.verifyPassword(ctx, password, authInfo.PwHash, authInfo.PwNormalized)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		if err := s.recordLoginFailure(ctx, repo, email, ip); err != nil {
+			return nil, err
+		}
 		return nil, errInvalidCredentials
 	}
 
+	if err := clearLoginFailures(ctx, repo, email); err != nil {
+		return nil, err
+	}
+
+	// Not critical enough to fail the login over, it's retried on the next one
+	if outdated {
+		if err := s.upgradePasswordHash(ctx, repo, authInfo.ID, password, authInfo.PwHash); err != nil {
+			log.Error().Err(err).Msg("failed to upgrade password hash")
+		}
+	}
+
+	// Only checked once the password is verified, so that it can't be probed without knowing the password
+	if s.cfg.Email.RequireVerified && authInfo.EmailVerifiedAt == nil {
+		return nil, errEmailNotVerified
+	}
+
 	return &authInfo.ID, nil
 }
 
+// upgradePasswordHash rehash a verified password with the current parameters. The old hash is only replaced if it is
+// still the stored one, so that a password changed in the meantime isn't overwritten.
+func (s *Service) upgradePasswordHash(ctx context.Context, repo *repository.Queries, userId uuid.UUID, password, oldHash string) error {
+	newHash, err := s.hasher.hashPassword(ctx, s.policy.normalizePassword(password))
+	if err != nil {
+		return err
+	}
+
+	params := repository.ReplacePasswordHashParams{
+		NewHash:      newHash,
+		PwNormalized: s.policy.normalize,
+		UserID:       userId,
+		OldHash:      oldHash,
+	}
+	if _, err := repo.ReplacePasswordHash(ctx, params); err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	return nil
+}
+
 type registerRq struct {
 	email     string
 	password  string
@@ -56,8 +175,20 @@ var (
 )
 
 // register validate the email provided in rq is not taken, and create a new user
-// with password-based authentication. Email verification is out-of-scope.
+// with password-based authentication. A verification token is sent to the email address, the account stays
+// unverified until it is presented to verifyEmail.
 func (s *Service) register(ctx context.Context, rq *registerRq) error {
+	password := s.policy.normalizePassword(rq.password)
+	if err := s.policy.check(password, rq.email, rq.firstName, rq.lastName); err != nil {
+		return err
+	}
+
+	// Hashed before the transaction is started, so that no connection is held while waiting for the hasher
+	pwHash, err := s.hasher.hashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("begin transaction failed: %w", err)
@@ -84,22 +215,26 @@ func (s *Service) register(ctx context.Context, rq *registerRq) error {
 		return fmt.Errorf("failed creating user: %w", err)
 	}
 
-	pwSalt, err := generateSalt()
-	if err != nil {
-		return fmt.Errorf("failed generating salt: %w", err)
-	}
-	pwHash := computeHash(rq.password, pwSalt)
-
 	createPasswordAuthParams := repository.CreatePasswordAuthParams{
-		UserID: userId,
-		PwHash: pwHash,
-		PwSalt: pwSalt,
+		UserID:       userId,
+		PwHash:       pwHash,
+		PwNormalized: s.policy.normalize,
 	}
 	err = repo.CreatePasswordAuth(ctx, createPasswordAuthParams)
 	if err != nil {
 		return fmt.Errorf("failed to create password auth: %w", err)
 	}
 
+	token, err := createOneTimeToken(ctx, repo, userId, tokenPurposeEmailVerification, emailVerificationTokenLifetime)
+	if err != nil {
+		return err
+	}
+	data := mail.TokenData{Token: token, ValidFor: emailVerificationTokenLifetime}
+	err = enqueueMail(ctx, repo, rq.email, mail.TemplateEmailVerification, data)
+	if err != nil {
+		return err
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("transaction commit failed: %w", err)
 	}
@@ -107,25 +242,32 @@ func (s *Service) register(ctx context.Context, rq *registerRq) error {
 	return nil
 }
 
-func (s *Service) generateApiKey(ctx context.Context, userId *uuid.UUID) (string, error) {
+type generateApiKeyRq struct {
+	name      string
+	scopes    []string
+	expiresAt *time.Time
+}
+
+func (s *Service) generateApiKey(ctx context.Context, userId *uuid.UUID, rq *generateApiKeyRq) (string, error) {
 	repo := repository.New(s.pool)
+	return s.createApiKey(ctx, repo, userId, rq)
+}
 
+func (s *Service) createApiKey(ctx context.Context, repo *repository.Queries, userId *uuid.UUID, rq *generateApiKeyRq) (string, error) {
 	key, err := _generateApiKey(ctx, repo.ApiKeyPublicIdTaken)
 	if err != nil {
 		return "", err
 	}
 
-	secretSalt, err := generateSalt()
-	if err != nil {
-		return "", err
-	}
-
-	secretHash := computeHash(key.secret, secretSalt)
 	params := repository.CreateApiKeyParams{
 		UserID:     *userId,
 		PublicID:   key.publicId,
-		SecretHash: secretHash,
-		SecretSalt: secretSalt,
+		SecretHash: s.computeApiKeyHmac(key.secret),
+		SecretSalt: []byte{},
+		HashScheme: apiKeyHashHmacSha256,
+		Name:       rq.name,
+		Scopes:     rq.scopes,
+		ExpiresAt:  rq.expiresAt,
 	}
 	if err := repo.CreateApiKey(ctx, params); err != nil {
 		return "", fmt.Errorf("failed to create api key: %w", err)
@@ -185,9 +327,17 @@ func generateRandomHex(length int) (string, error) {
 
 var (
 	errApiKeyInvalid = errors.New("invalid api key")
+	errApiKeyExpired = errors.New("api key expired")
 )
 
-func (s *Service) validateApiKey(ctx context.Context, inputApiKey *apiKey) (*uuid.UUID, error) {
+// authenticatedApiKey an API key that passed validation
+type authenticatedApiKey struct {
+	userId   uuid.UUID
+	publicId string
+	scopes   []string
+}
+
+func (s *Service) validateApiKey(ctx context.Context, inputApiKey *apiKey) (*authenticatedApiKey, error) {
 	repo := repository.New(s.pool)
 	dbApiKey, err := repo.FindApiKey(ctx, inputApiKey.publicId)
 	if errors.Is(err, sql.ErrNoRows) {
@@ -196,10 +346,382 @@ func (s *Service) validateApiKey(ctx context.Context, inputApiKey *apiKey) (*uui
 		return nil, fmt.Errorf("error fetching admin api key: %w", err)
 	}
 
-	inputHash := computeHash(inputApiKey.secret, dbApiKey.SecretSalt)
-	if !bytes.Equal(dbApiKey.SecretHash, inputHash) {
+	if dbApiKey.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: admin api key revoked", errApiKeyInvalid)
+	}
+
+	valid, err := s.verifyApiKeySecret(ctx, dbApiKey.HashScheme, inputApiKey.secret, dbApiKey.SecretSalt, dbApiKey.SecretHash)
+	if err != nil {
+		return nil, err
+	} else if !valid {
 		return nil, fmt.Errorf("%w: admin api key secret invalid", errApiKeyInvalid)
 	}
 
-	return &dbApiKey.UserID, nil
+	// Keys issued before the HMAC scheme are upgraded on their first use, so the argon2 cost is only paid once
+	if dbApiKey.HashScheme != apiKeyHashHmacSha256 {
+		params := repository.UpgradeApiKeyHashParams{
+			ID:         dbApiKey.ID,
+			SecretHash: s.computeApiKeyHmac(inputApiKey.secret),
+			SecretSalt: []byte{},
+			HashScheme: apiKeyHashHmacSha256,
+		}
+		if err := repo.UpgradeApiKeyHash(ctx, params); err != nil {
+			log.Error().Err(err).Msg("failed to upgrade api key hash")
+		}
+	}
+
+	// Only checked once the secret is verified, so that expiry can't be probed without holding the key
+	if dbApiKey.ExpiresAt != nil && !time.Now().Before(*dbApiKey.ExpiresAt) {
+		return nil, errApiKeyExpired
+	}
+
+	// Not critical enough to fail the request over
+	if err := repo.TouchApiKey(ctx, dbApiKey.ID); err != nil {
+		log.Error().Err(err).Msg("failed to update last use of api key")
+	}
+
+	return &authenticatedApiKey{
+		userId:   dbApiKey.UserID,
+		publicId: dbApiKey.PublicID,
+		scopes:   dbApiKey.Scopes,
+	}, nil
+}
+
+const (
+	apiKeyHashArgon2id   = "argon2id"
+	apiKeyHashHmacSha256 = "hmac-sha256"
+)
+
+var (
+	errUnknownHashScheme = errors.New("unknown api key hash scheme")
+)
+
+// verifyApiKeySecret check an API key secret against its stored hash. API key secrets are 32 random bytes, so unlike
+// passwords they don't need a slow hash to resist brute force, a keyed HMAC is just as safe and orders of magnitude
+// cheaper. Keys issued before the HMAC scheme are still hashed with argon2.
+func (s *Service) verifyApiKeySecret(ctx context.Context, scheme, secret string, salt, hash []byte) (bool, error) {
+	switch scheme {
+	case apiKeyHashHmacSha256:
+		return hmac.Equal(s.computeApiKeyHmac(secret), hash), nil
+	case apiKeyHashArgon2id:
+		computed, err := s.hasher.hash(ctx, secret, salt)
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(computed, hash), nil
+	}
+	return false, fmt.Errorf("%w: %s", errUnknownHashScheme, scheme)
+}
+
+func (s *Service) computeApiKeyHmac(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(s.cfg.ApiKey.HashKey))
+	mac.Write([]byte(secret))
+	return mac.Sum(nil)
+}
+
+// Statuses of listed API keys
+const (
+	apiKeyStatusActive = "active"
+	// apiKeyStatusRotated a key that was replaced by a successor, valid until the end of its grace period
+	apiKeyStatusRotated = "rotated"
+)
+
+type apiKeyRs struct {
+	publicId   string
+	name       string
+	scopes     []string
+	status     string
+	createdAt  time.Time
+	lastUsedAt *time.Time
+	expiresAt  *time.Time
+}
+
+// listApiKeys list the API keys of the user that have neither been revoked nor expired
+func (s *Service) listApiKeys(ctx context.Context, userId *uuid.UUID) ([]apiKeyRs, error) {
+	repo := repository.New(s.pool)
+	rows, err := repo.ListApiKeys(ctx, *userId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	keys := make([]apiKeyRs, 0, len(rows))
+	for _, row := range rows {
+		status := apiKeyStatusActive
+		if row.RotatedAt != nil {
+			status = apiKeyStatusRotated
+		}
+		keys = append(keys, apiKeyRs{
+			publicId:   row.PublicID,
+			name:       row.Name,
+			scopes:     row.Scopes,
+			status:     status,
+			createdAt:  row.CreatedAt,
+			lastUsedAt: row.LastUsedAt,
+			expiresAt:  row.ExpiresAt,
+		})
+	}
+	return keys, nil
+}
+
+var (
+	errApiKeyNotFound = errors.New("api key not found")
+	errApiKeyRotated  = errors.New("api key already rotated")
+)
+
+// revokeApiKey revoke an API key of the user, it is rejected by ApiKeyAuth from then on
+func (s *Service) revokeApiKey(ctx context.Context, userId *uuid.UUID, publicId string) error {
+	repo := repository.New(s.pool)
+	params := repository.RevokeApiKeyParams{
+		UserID:   *userId,
+		PublicID: publicId,
+	}
+	revoked, err := repo.RevokeApiKey(ctx, params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if revoked == 0 {
+		return errApiKeyNotFound
+	}
+	return nil
+}
+
+type apiKeyRotationRs struct {
+	apiKey               string
+	predecessorExpiresAt time.Time
+}
+
+// rotateApiKey issue a successor with the same name and scopes for an API key of the user. The predecessor remains
+// valid for the configured grace period, so that clients can switch to the successor without an outage. If the
+// predecessor had an expiry, the successor gets the same lifetime.
+func (s *Service) rotateApiKey(ctx context.Context, userId *uuid.UUID, publicId string) (*apiKeyRotationRs, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	params := repository.FindApiKeyForRotationParams{
+		UserID:   *userId,
+		PublicID: publicId,
+	}
+	predecessor, err := repo.FindApiKeyForRotation(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errApiKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	now := time.Now()
+	if predecessor.RotatedAt != nil {
+		return nil, errApiKeyRotated
+	}
+	if predecessor.ExpiresAt != nil && !now.Before(*predecessor.ExpiresAt) {
+		return nil, errApiKeyExpired
+	}
+
+	rq := &generateApiKeyRq{
+		name:   predecessor.Name,
+		scopes: predecessor.Scopes,
+	}
+	if predecessor.ExpiresAt != nil {
+		expiresAt := now.Add(predecessor.ExpiresAt.Sub(predecessor.CreatedAt))
+		rq.expiresAt = &expiresAt
+	}
+	successor, err := s.createApiKey(ctx, repo, userId, rq)
+	if err != nil {
+		return nil, err
+	}
+
+	predecessorExpiresAt := now.Add(s.cfg.ApiKey.RotationGracePeriod)
+	if predecessor.ExpiresAt != nil && predecessor.ExpiresAt.Before(predecessorExpiresAt) {
+		predecessorExpiresAt = *predecessor.ExpiresAt
+	}
+	rotatedParams := repository.MarkApiKeyRotatedParams{
+		ID:        predecessor.ID,
+		ExpiresAt: &predecessorExpiresAt,
+	}
+	if err := repo.MarkApiKeyRotated(ctx, rotatedParams); err != nil {
+		return nil, fmt.Errorf("failed to mark api key rotated: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("transaction commit failed: %w", err)
+	}
+
+	return &apiKeyRotationRs{apiKey: successor, predecessorExpiresAt: predecessorExpiresAt}, nil
+}
+
+const (
+	accessTokenLifetime  = 1 * time.Hour
+	refreshTokenLifetime = 30 * 24 * time.Hour
+)
+
+var (
+	errRefreshTokenInvalid = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// signAccessToken issue a JWT access token for the user, signed with the current signing key
+func (s *Service) signAccessToken(userId *uuid.UUID) (string, error) {
+	key := s.keys.signing()
+	now := time.Now()
+	token := jwt.NewWithClaims(key.method, jwt.MapClaims{
+		"sub": userId.String(),
+		"jti": uuid.New().String(),
+		"iat": now.Unix(),
+		"exp": now.Add(accessTokenLifetime).Unix(),
+		"alg": key.method.Alg(),
+	})
+	token.Header["kid"] = key.id
+	return token.SignedString(key.signKey)
+}
+
+// revokeAccessToken deny the access token until it expires
+func (s *Service) revokeAccessToken(ctx context.Context, token *accessToken) error {
+	repo := repository.New(s.pool)
+	params := repository.CreateRevokedTokenParams{
+		Jti:       token.jti,
+		UserID:    token.userId,
+		ExpiresAt: token.expiresAt,
+	}
+	if err := repo.CreateRevokedToken(ctx, params); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	s.revoked.add(token.jti, token.expiresAt)
+	return nil
+}
+
+// cutOffAccessTokens revoke every access token issued to the user so far. The cutoff only takes effect in the cache of
+// this instance once the returned value is passed to denylist.addCutoff, which should happen after the transaction of
+// repo is committed.
+func cutOffAccessTokens(ctx context.Context, repo *repository.Queries, userId uuid.UUID) (tokenCutoff, error) {
+	now := time.Now()
+	cutoff := tokenCutoff{revokedBefore: now, expiresAt: now.Add(accessTokenLifetime)}
+	params := repository.SetTokenCutoffParams{
+		UserID:        userId,
+		RevokedBefore: cutoff.revokedBefore,
+		ExpiresAt:     cutoff.expiresAt,
+	}
+	if err := repo.SetTokenCutoff(ctx, params); err != nil {
+		return tokenCutoff{}, fmt.Errorf("failed to set token cutoff: %w", err)
+	}
+	return cutoff, nil
+}
+
+// publicKeys return the keys access tokens can be verified with in JWK format, omitting symmetric keys
+func (s *Service) publicKeys() []Jwk {
+	keys := []Jwk{}
+	for _, key := range s.keys.verificationKeys() {
+		if jwk, ok := key.jwk(); ok {
+			keys = append(keys, *jwk)
+		}
+	}
+	return keys
+}
+
+// createRefreshToken start a new refresh token family for the user and return its first token.
+func (s *Service) createRefreshToken(ctx context.Context, userId *uuid.UUID) (string, error) {
+	repo := repository.New(s.pool)
+	return _createRefreshToken(ctx, repo, *userId, uuid.New())
+}
+
+// rotateRefreshToken exchange a refresh token for a new one in the same family. Every refresh token is single-use:
+// presenting one that was already rotated revokes the whole family, as either the legitimate client or an attacker
+// is holding a stolen copy, and we cannot tell which one.
+// Return the id of the user the token belongs to and the new refresh token.
+func (s *Service) rotateRefreshToken(ctx context.Context, rawToken string) (*uuid.UUID, string, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	token, err := repo.FindRefreshTokenForUpdate(ctx, hashToken(rawToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", fmt.Errorf("%w: refresh token not found", errRefreshTokenInvalid)
+	} else if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	if token.RevokedAt != nil {
+		return nil, "", fmt.Errorf("%w: refresh token family revoked", errRefreshTokenInvalid)
+	}
+	if token.UsedAt != nil {
+		if err := repo.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+			return nil, "", fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, "", fmt.Errorf("transaction commit failed: %w", err)
+		}
+		return nil, "", errRefreshTokenReused
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, "", fmt.Errorf("%w: refresh token expired", errRefreshTokenInvalid)
+	}
+
+	if err := repo.MarkRefreshTokenUsed(ctx, token.ID); err != nil {
+		return nil, "", fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+
+	newToken, err := _createRefreshToken(ctx, repo, token.UserID, token.FamilyID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, "", fmt.Errorf("transaction commit failed: %w", err)
+	}
+
+	return &token.UserID, newToken, nil
+}
+
+// revokeRefreshToken revoke the family of a refresh token belonging to the user
+func (s *Service) revokeRefreshToken(ctx context.Context, userId *uuid.UUID, rawToken string) error {
+	repo := repository.New(s.pool)
+
+	token, err := repo.FindRefreshToken(ctx, hashToken(rawToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: refresh token not found", errRefreshTokenInvalid)
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if token.UserID != *userId {
+		return fmt.Errorf("%w: refresh token belongs to another user", errRefreshTokenInvalid)
+	}
+
+	if err := repo.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+func _createRefreshToken(ctx context.Context, repo *repository.Queries, userId uuid.UUID, familyId uuid.UUID) (string, error) {
+	token, err := generateRandomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	params := repository.CreateRefreshTokenParams{
+		UserID:    userId,
+		FamilyID:  familyId,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(refreshTokenLifetime),
+	}
+	if err := repo.CreateRefreshToken(ctx, params); err != nil {
+		return "", fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// hashToken refresh tokens and MFA challenges are 32 random bytes and are looked up by their hash, so a fast unsalted
+// hash is sufficient, unlike with passwords.
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
 }
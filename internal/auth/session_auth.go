@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"net/http"
@@ -22,8 +23,36 @@ func (api *Api) SessionAuth(next http.Handler) http.Handler {
 			if err := api.sessionStore.Destroy(r.Context()); err != nil {
 				log.Error().Err(err).Msg("failed to destroy faulty session (invalid UUID)")
 			}
+			return
+		}
+
+		// Sessions started before their metadata was recorded have no id, they are logged out like revoked ones
+		sessionId, err := uuid.Parse(api.sessionStore.GetString(r.Context(), "session_id"))
+		if err != nil {
+			api.rejectSession(w, r)
+			return
+		}
+
+		err = api.s.touchUserSession(r.Context(), userId, sessionId)
+		if errors.Is(err, errSessionNotFound) {
+			api.rejectSession(w, r)
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("failed to look up session")
+			return
 		}
 
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "id", &userId)))
+		ctx := context.WithValue(r.Context(), "id", &userId)
+		ctx = context.WithValue(ctx, "session_id", sessionId)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// rejectSession destroy a session that was revoked or has expired, and answer the request as unauthenticated
+func (api *Api) rejectSession(w http.ResponseWriter, r *http.Request) {
+	if err := api.sessionStore.Destroy(r.Context()); err != nil {
+		log.Error().Err(err).Msg("failed to destroy revoked session")
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
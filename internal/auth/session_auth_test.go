@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"auth-strategies/internal/config"
+	"auth-strategies/internal/db/repository"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const sessionTestPassword = "correct horse battery staple"
+
+// sessionTestApi an Api backed by the test database, with sessions kept in memory
+func sessionTestApi(t *testing.T, pool *pgxpool.Pool) *Api {
+	cfg := &config.Config{
+		Server: config.ServerConfig{HmacSecret: "test", PublicUrl: "http://localhost"},
+		Token: config.TokenConfig{
+			KeyRefreshInterval:     time.Minute,
+			RevocationSyncInterval: time.Minute,
+		},
+		Mfa:      config.MfaConfig{Issuer: "test"},
+		Webauthn: config.WebauthnConfig{RpId: "localhost", RpDisplayName: "test", RpOrigins: []string{"http://localhost"}},
+		Lockout: config.LockoutConfig{
+			AccountThreshold: 5,
+			IpThreshold:      100,
+			MfaThreshold:     5,
+			BaseDuration:     time.Minute,
+			MaxDuration:      time.Hour,
+			FailureWindow:    time.Hour,
+		},
+		Hashing: config.HashingConfig{
+			MaxConcurrent: 4,
+			MaxQueue:      16,
+			MaxWait:       time.Minute,
+			Argon2:        config.Argon2Config{Time: 1, Memory: 8 * 1024, Threads: 1, KeyLength: 32, SaltLength: 16},
+		},
+		Password: config.PasswordConfig{MinLength: 8, MaxLength: 256, Normalize: true},
+	}
+	s, err := NewService(context.Background(), pool, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionStore := scs.New()
+	sessionStore.Store = memstore.New()
+	return NewApi(s, sessionStore)
+}
+
+// sessionTestRouter the session routes involved in logging in, set up like the server does
+func sessionTestRouter(api *Api) http.Handler {
+	r := chi.NewRouter()
+	r.Use(api.sessionStore.LoadAndSave)
+	r.Route("/auth", func(r chi.Router) {
+		r.Use(api.Csrf)
+		r.With(api.CsrfLogin).Post("/login", api.Login)
+		r.Post("/mfa/verify", api.VerifyMfa)
+		r.With(api.SessionAuth).Post("/password", api.ChangePassword)
+		r.Get("/csrf", api.CsrfToken)
+		r.With(api.SessionAuth).Get("/sessions", api.ListSessions)
+	})
+	return r
+}
+
+// testPasswordUser create a user with sessionTestPassword as their password
+func testPasswordUser(t *testing.T, api *Api) (uuid.UUID, string) {
+	userId, email := testUser(t, api.s.pool)
+	pwHash, err := api.s.hasher.hashPassword(context.Background(), sessionTestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := repository.SetPasswordAuthParams{
+		UserID:       userId,
+		PwHash:       pwHash,
+		PwNormalized: true,
+	}
+	if err := repository.New(api.s.pool).SetPasswordAuth(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	return userId, email
+}
+
+// enableTestTotp give the user a confirmed TOTP secret, return a function computing its current code
+func enableTestTotp(t *testing.T, api *Api, userId uuid.UUID) func() string {
+	secret, err := generateTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.New(api.s.pool)
+	createParams := repository.CreateTotpSecretParams{
+		UserID: userId,
+		Secret: secret,
+	}
+	if _, err := repo.CreateTotpSecret(context.Background(), createParams); err != nil {
+		t.Fatal(err)
+	}
+	confirmParams := repository.ConfirmTotpSecretParams{
+		UserID:       userId,
+		LastUsedStep: totpStep(time.Now()) - totpSkew - 1,
+	}
+	if err := repo.ConfirmTotpSecret(context.Background(), confirmParams); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() string {
+		return totpCode(key, totpStep(time.Now()))
+	}
+}
+
+// sessionRequest send a request with the session cookie, if any, and a JSON body, if any. Return the response, and the
+// session cookie the response sets, or the one sent if it sets none.
+func sessionRequest(
+	t *testing.T,
+	h http.Handler,
+	method, path string,
+	body any,
+	cookie *http.Cookie,
+	header http.Header,
+) (*httptest.ResponseRecorder, *http.Cookie) {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, path, &payload)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			cookie = c
+		}
+	}
+	return w, cookie
+}
+
+// csrfHeaderOf fetch the CSRF token of the session of the cookie, starting one if there is none. Return the header to
+// send it in, and the session cookie.
+func csrfHeaderOf(t *testing.T, h http.Handler, cookie *http.Cookie) (http.Header, *http.Cookie) {
+	w, cookie := sessionRequest(t, h, http.MethodGet, "/auth/csrf", nil, cookie, nil)
+	if w.Code != http.StatusOK || cookie == nil {
+		t.Fatalf("no csrf token: status %d", w.Code)
+	}
+	csrf := &CsrfTokenResponse{}
+	if err := json.NewDecoder(w.Body).Decode(csrf); err != nil {
+		t.Fatal(err)
+	}
+	return http.Header{csrfHeader: {csrf.CsrfToken}}, cookie
+}
+
+// plantSession start an anonymous session the way an attacker would before planting its cookie in the browser of the
+// victim. The victim then fetches the CSRF token of the planted session to log in, as the session is all they have.
+func plantSession(t *testing.T, h http.Handler) (http.Header, *http.Cookie) {
+	return csrfHeaderOf(t, h, nil)
+}
+
+// assertLoggedIn check whether the session of the cookie is accepted by SessionAuth
+func assertLoggedIn(t *testing.T, h http.Handler, cookie *http.Cookie, want bool) {
+	t.Helper()
+	w, _ := sessionRequest(t, h, http.MethodGet, "/auth/sessions", nil, cookie, nil)
+	if loggedIn := w.Code == http.StatusOK; loggedIn != want {
+		t.Fatalf("session logged in: %t, want %t (status %d)", loggedIn, want, w.Code)
+	}
+}
+
+// TestSessionFixation an attacker starts a session, plants its cookie in the browser of the victim and waits for them
+// to log in. Logging in, with or without a second factor, and changing the password have to move the session to a new
+// token, so that the planted cookie never gets logged in, and a cookie leaked before a password change stops working.
+//
+// Users have no roles or other privileges that could change within a session, so there is no privilege change to test.
+func TestSessionFixation(t *testing.T) {
+	pool := testPool(t)
+
+	t.Run("password login", func(t *testing.T) {
+		api := sessionTestApi(t, pool)
+		h := sessionTestRouter(api)
+		_, email := testPasswordUser(t, api)
+
+		header, planted := plantSession(t, h)
+		login := LoginData{Email: email, Password: sessionTestPassword}
+		w, loggedIn := sessionRequest(t, h, http.MethodPost, "/auth/login", login, planted, header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login failed: status %d", w.Code)
+		}
+		if loggedIn.Value == planted.Value {
+			t.Fatal("session token not renewed on login")
+		}
+
+		assertLoggedIn(t, h, planted, false)
+		assertLoggedIn(t, h, loggedIn, true)
+	})
+
+	t.Run("login with a second factor", func(t *testing.T) {
+		api := sessionTestApi(t, pool)
+		h := sessionTestRouter(api)
+		userId, email := testPasswordUser(t, api)
+		code := enableTestTotp(t, api, userId)
+
+		header, planted := plantSession(t, h)
+		login := LoginData{Email: email, Password: sessionTestPassword}
+		w, afterPassword := sessionRequest(t, h, http.MethodPost, "/auth/login", login, planted, header)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("no mfa challenge: status %d", w.Code)
+		}
+		challenge := &MfaChallengeResponse{}
+		if err := json.NewDecoder(w.Body).Decode(challenge); err != nil {
+			t.Fatal(err)
+		}
+		assertLoggedIn(t, h, afterPassword, false)
+
+		verify := MfaVerifyData{Challenge: challenge.Challenge, Code: code()}
+		w, loggedIn := sessionRequest(t, h, http.MethodPost, "/auth/mfa/verify", verify, afterPassword, header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("mfa verification failed: status %d", w.Code)
+		}
+		if loggedIn.Value == planted.Value {
+			t.Fatal("session token not renewed on login")
+		}
+
+		assertLoggedIn(t, h, planted, false)
+		assertLoggedIn(t, h, loggedIn, true)
+	})
+
+	t.Run("password change", func(t *testing.T) {
+		api := sessionTestApi(t, pool)
+		h := sessionTestRouter(api)
+		_, email := testPasswordUser(t, api)
+
+		header, anonymous := csrfHeaderOf(t, h, nil)
+		login := LoginData{Email: email, Password: sessionTestPassword}
+		w, before := sessionRequest(t, h, http.MethodPost, "/auth/login", login, anonymous, header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login failed: status %d", w.Code)
+		}
+
+		// The token of the anonymous session was replaced on login
+		header, before = csrfHeaderOf(t, h, before)
+		change := ChangePasswordData{CurrentPassword: sessionTestPassword, NewPassword: "a completely different passphrase"}
+		w, after := sessionRequest(t, h, http.MethodPost, "/auth/password", change, before, header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("password change failed: status %d", w.Code)
+		}
+		if after.Value == before.Value {
+			t.Fatal("session token not renewed on password change")
+		}
+
+		assertLoggedIn(t, h, before, false)
+		assertLoggedIn(t, h, after, true)
+
+		// So is the token of the session from before the password change
+		w, _ = sessionRequest(t, h, http.MethodPost, "/auth/password", change, after, header)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("csrf token kept across password change: status %d", w.Code)
+		}
+	})
+}
+
+// TestLoginCsrf another site can't log the browser of a user in, into an account of the attacker: logging a session in
+// requires the CSRF token even while the session is anonymous.
+func TestLoginCsrf(t *testing.T) {
+	pool := testPool(t)
+	api := sessionTestApi(t, pool)
+	h := sessionTestRouter(api)
+	userId, email := testPasswordUser(t, api)
+
+	_, anonymous := csrfHeaderOf(t, h, nil)
+	login := LoginData{Email: email, Password: sessionTestPassword}
+	w, _ := sessionRequest(t, h, http.MethodPost, "/auth/login", login, anonymous, nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("login without csrf token: status %d", w.Code)
+	}
+
+	// The attacker completes the first factor themselves, and only has the browser submit the second one
+	code := enableTestTotp(t, api, userId)
+	challenge, err := api.s.createMfaChallenge(context.Background(), &userId, loginModeSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := MfaVerifyData{Challenge: challenge, Code: code()}
+	w, _ = sessionRequest(t, h, http.MethodPost, "/auth/mfa/verify", verify, anonymous, nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("mfa verification without csrf token: status %d", w.Code)
+	}
+	assertLoggedIn(t, h, anonymous, false)
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+)
+
+// signingKey a key JWT access tokens are signed and verified with
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	// signKey is the private key for asymmetric methods and the shared secret for HS256
+	signKey any
+	// verifyKey is the public key for asymmetric methods and the shared secret for HS256
+	verifyKey any
+}
+
+var (
+	errUnsupportedKey = errors.New("unsupported signing key")
+)
+
+// loadSigningKey read a PEM encoded RSA, ECDSA or Ed25519 private key from privateKeyFile. If no file is given, fall
+// back to HS256 with hmacSecret. When keyId is empty, the RFC 7638 thumbprint of the public key is used as key id.
+func loadSigningKey(privateKeyFile string, keyId string, hmacSecret []byte) (*signingKey, error) {
+	if privateKeyFile == "" {
+		return newHmacSigningKey(keyId, hmacSecret), nil
+	}
+
+	data, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	privateKey, err := parsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAsymmetricSigningKey(keyId, privateKey)
+}
+
+func newHmacSigningKey(keyId string, secret []byte) *signingKey {
+	if keyId == "" {
+		// The secret is 256 bits of randomness, so a truncated hash of it is safe to publish
+		hash := sha256.Sum256(secret)
+		keyId = "hs256-" + hex.EncodeToString(hash[:8])
+	}
+	return &signingKey{
+		id:        keyId,
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func newAsymmetricSigningKey(keyId string, privateKey crypto.Signer) (*signingKey, error) {
+	method, err := signingMethodFor(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		id:        keyId,
+		method:    method,
+		signKey:   privateKey,
+		verifyKey: privateKey.Public(),
+	}
+	if key.id == "" {
+		jwk, _ := key.jwk()
+		key.id, err = jwkThumbprint(jwk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", errUnsupportedKey)
+	}
+
+	var privateKey any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unexpected PEM block type %q", errUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", errUnsupportedKey, privateKey)
+	}
+	return signer, nil
+}
+
+func signingMethodFor(privateKey crypto.Signer) (jwt.SigningMethod, error) {
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%w: RSA keys must be at least 2048 bits", errUnsupportedKey)
+		}
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("%w: unsupported curve %s", errUnsupportedKey, k.Curve.Params().Name)
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("%w: %T", errUnsupportedKey, privateKey)
+}
+
+// Jwk a public key in JSON Web Key format (RFC 7517)
+type Jwk struct {
+	Kty string `json:"kty" validate:"required" example:"OKP"`
+	Kid string `json:"kid" validate:"required" example:"NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"`
+	Use string `json:"use" validate:"required" example:"sig"`
+	Alg string `json:"alg" validate:"required" example:"EdDSA"`
+	Crv string `json:"crv,omitempty" example:"Ed25519"`
+	X   string `json:"x,omitempty" example:"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// jwk return the public half of the key as a JWK. Symmetric keys must never be published, so the second return value
+// is false for them.
+func (k *signingKey) jwk() (*Jwk, bool) {
+	jwk := &Jwk{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return nil, false
+	}
+	return jwk, true
+}
+
+// jwkThumbprint compute the RFC 7638 thumbprint of a public key: the hash of its required members in lexicographic
+// order. Marshalling a map sorts its keys, which is exactly the canonical form.
+func jwkThumbprint(jwk *Jwk) (string, error) {
+	members := map[string]string{"kty": jwk.Kty}
+	switch jwk.Kty {
+	case "RSA":
+		members["n"] = jwk.N
+		members["e"] = jwk.E
+	case "EC":
+		members["crv"] = jwk.Crv
+		members["x"] = jwk.X
+		members["y"] = jwk.Y
+	case "OKP":
+		members["crv"] = jwk.Crv
+		members["x"] = jwk.X
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jwk: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
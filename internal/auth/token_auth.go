@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func (api *Api) TokenAuth(next http.Handler) http.Handler {
@@ -21,8 +22,11 @@ func (api *Api) TokenAuth(next http.Handler) http.Handler {
 		}
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		id, err := validateToken(api.hmacSecret, tokenString)
-		if errors.Is(err, errInvalidToken) {
+		token, err := api.s.validateToken(tokenString)
+		if errors.Is(err, errTokenRevoked) {
+			common.WriteJSON(w, http.StatusUnauthorized, common.ErrorResponse{Error: "Token revoked"})
+			return
+		} else if errors.Is(err, errInvalidToken) {
 			common.WriteJSON(w, http.StatusUnauthorized, common.ErrorResponse{Error: "Invalid token"})
 			return
 		} else if err != nil {
@@ -31,20 +35,39 @@ func (api *Api) TokenAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "id", id)))
+		ctx := context.WithValue(r.Context(), "id", &token.userId)
+		ctx = context.WithValue(ctx, "token", token)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
 var (
 	errInvalidToken     = errors.New("invalid token")
+	errTokenRevoked     = errors.New("token revoked")
 	errClaimsCastFailed = errors.New("failed to cast jwt claims to MapClaims")
 	errInvalidClaims    = errors.New("invalid claims")
 )
 
-func validateToken(hmacSecret []byte, tokenString string) (*uuid.UUID, error) {
+// accessToken the claims of a validated access token
+type accessToken struct {
+	userId    uuid.UUID
+	jti       uuid.UUID
+	expiresAt time.Time
+}
+
+func (s *Service) validateToken(tokenString string) (*accessToken, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return hmacSecret, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys.verification(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		// Only accept the algorithm of the key, so that e.g. a public key can't be abused as an HMAC secret
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	}, jwt.WithExpirationRequired())
 	if err != nil || !token.Valid {
 		return nil, fmt.Errorf("%w: %w", errInvalidToken, err)
 	}
@@ -60,6 +83,32 @@ func validateToken(hmacSecret []byte, tokenString string) (*uuid.UUID, error) {
 		if err != nil {
 			return nil, fmt.Errorf("%w: subject is not a valid UUID: %w", errInvalidClaims, err)
 		}
-		return &id, nil
+
+		// Tokens without a jti could not be revoked, so they are not accepted at all
+		jtiStr, _ := claims["jti"].(string)
+		jti, err := uuid.Parse(jtiStr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: missing or malformed jti: %w", errInvalidToken, err)
+		}
+		if s.revoked.contains(jti) {
+			return nil, errTokenRevoked
+		}
+
+		// Likewise for iat, which a cutoff revoking every token of the user is compared against
+		iat, err := claims.GetIssuedAt()
+		if err != nil || iat == nil {
+			return nil, fmt.Errorf("%w: missing or malformed iat: %w", errInvalidToken, err)
+		}
+		if s.revoked.cutOff(id, iat.Time) {
+			return nil, errTokenRevoked
+		}
+
+		// The parser has already made sure exp is present and valid
+		exp, err := claims.GetExpirationTime()
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed expiration time in JWT: %w", errInvalidClaims, err)
+		}
+
+		return &accessToken{userId: id, jti: jti, expiresAt: exp.Time}, nil
 	}
 }
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator app supports, some ignore any other value.
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew is how many time steps a code may lag behind or run ahead of the server clock
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTotpSecret generate a 160-bit secret as recommended by RFC 4226, base32 encoded like authenticator apps
+// expect it.
+func generateTotpSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// totpCode compute the code of the secret for a time step: HOTP (RFC 4226) with the step as the counter
+func totpCode(secret []byte, step int64) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, truncated%uint32(math.Pow10(totpDigits)))
+}
+
+// matchTotpCode return the time step the code belongs to, if it is valid at now. Codes of steps up to lastUsedStep
+// are rejected, so that a code can't be replayed, not even within its own time step.
+func matchTotpCode(secret string, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpUri format the otpauth:// URI authenticator apps import secrets from, usually via a QR code
+func totpUri(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	// url.Values encodes spaces as "+", which authenticator apps display literally
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+var (
+	errTotpAlreadyEnrolled = errors.New("totp already enrolled")
+	errTotpNotEnrolled     = errors.New("totp not enrolled")
+	errInvalidTotpCode     = errors.New("invalid totp code")
+)
+
+type totpEnrollmentRs struct {
+	secret string
+	uri    string
+}
+
+// enrollTotp generate a TOTP secret for the user. It only becomes a second factor once confirmed with a code, until
+// then enrolling again replaces it.
+func (s *Service) enrollTotp(ctx context.Context, userId *uuid.UUID) (*totpEnrollmentRs, error) {
+	repo := repository.New(s.pool)
+
+	email, err := repo.GetUserEmail(ctx, *userId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	secret, err := generateTotpSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	params := repository.CreateTotpSecretParams{
+		UserID: *userId,
+		Secret: secret,
+	}
+	created, err := repo.CreateTotpSecret(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create totp secret: %w", err)
+	}
+	if created == 0 {
+		return nil, errTotpAlreadyEnrolled
+	}
+
+	return &totpEnrollmentRs{secret: secret, uri: totpUri(s.cfg.Mfa.Issuer, email, secret)}, nil
+}
+
+// confirmTotp enable TOTP as a second factor of the user, proving the authenticator app was set up correctly. Return
+// a fresh set of recovery codes, in case the authenticator app is lost.
+//
+// The code is checked before the recovery codes are hashed, so that wrong codes don't cost any hashing, and checked
+// again in the transaction, as the secret may have been replaced or confirmed meanwhile.
+func (s *Service) confirmTotp(ctx context.Context, userId *uuid.UUID, code string) ([]string, error) {
+	pending, err := repository.New(s.pool).FindTotpSecret(ctx, *userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTotpNotEnrolled
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+	if _, err := matchTotpConfirmation(pending.Secret, pending.LastUsedStep, pending.ConfirmedAt, code); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := generateRecoveryCodes(ctx, s.hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	totp, err := repo.FindTotpSecretForUpdate(ctx, *userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errTotpNotEnrolled
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+	step, err := matchTotpConfirmation(totp.Secret, totp.LastUsedStep, totp.ConfirmedAt, code)
+	if err != nil {
+		return nil, err
+	}
+
+	params := repository.ConfirmTotpSecretParams{
+		UserID:       *userId,
+		LastUsedStep: step,
+	}
+	if err := repo.ConfirmTotpSecret(ctx, params); err != nil {
+		return nil, fmt.Errorf("failed to confirm totp secret: %w", err)
+	}
+
+	if err := storeRecoveryCodes(ctx, repo, *userId, recoveryCodes); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return recoveryCodes.codes, nil
+}
+
+// matchTotpConfirmation check a code confirming a TOTP secret that is not confirmed yet, return the time step it matched
+func matchTotpConfirmation(secret string, lastUsedStep int64, confirmedAt *time.Time, code string) (int64, error) {
+	if confirmedAt != nil {
+		return 0, errTotpAlreadyEnrolled
+	}
+	step, ok := matchTotpCode(secret, code, time.Now(), lastUsedStep)
+	if !ok {
+		return 0, errInvalidTotpCode
+	}
+	return step, nil
+}
+
+// verifyTotp check a code against the confirmed TOTP secret of the user, and burn its time step if it is valid
+func verifyTotp(ctx context.Context, repo *repository.Queries, userId uuid.UUID, code string) (bool, error) {
+	totp, err := repo.FindTotpSecretForUpdate(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("%w: %w", errDb, err)
+	}
+	if totp.ConfirmedAt == nil {
+		return false, nil
+	}
+
+	step, ok := matchTotpCode(totp.Secret, code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+
+	params := repository.MarkTotpStepUsedParams{
+		UserID:       userId,
+		LastUsedStep: step,
+	}
+	if err := repo.MarkTotpStepUsed(ctx, params); err != nil {
+		return false, fmt.Errorf("failed to mark totp step used: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+	"unicode/utf8"
+)
+
+// maxUserAgentLength bounds the user agent stored along with a session, the header is chosen by the client
+const maxUserAgentLength = 512
+
+var (
+	errSessionNotFound = errors.New("session not found")
+)
+
+type createUserSessionRq struct {
+	userId    uuid.UUID
+	ip        string
+	userAgent string
+	expiresAt time.Time
+}
+
+// createUserSession record the metadata of a new session of the user, return its id. The session is only accepted by
+// touchUserSession while the record exists.
+func (s *Service) createUserSession(ctx context.Context, rq *createUserSessionRq) (uuid.UUID, error) {
+	repo := repository.New(s.pool)
+
+	// Expired sessions are never looked up again, so they are cleaned up opportunistically
+	if err := repo.DeleteExpiredUserSessions(ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	userAgent := rq.userAgent
+	for len(userAgent) > maxUserAgentLength {
+		_, size := utf8.DecodeLastRuneInString(userAgent)
+		userAgent = userAgent[:len(userAgent)-size]
+	}
+
+	params := repository.CreateUserSessionParams{
+		UserID:    rq.userId,
+		Ip:        rq.ip,
+		UserAgent: userAgent,
+		ExpiresAt: rq.expiresAt,
+	}
+	sessionId, err := repo.CreateUserSession(ctx, params)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+	return sessionId, nil
+}
+
+// touchUserSession make sure the session of the user has neither been revoked nor expired, and record that it was seen.
+// Like the last use of API keys, this is recorded at most once a minute, sparing most requests a database write.
+func (s *Service) touchUserSession(ctx context.Context, userId, sessionId uuid.UUID) error {
+	params := repository.TouchUserSessionParams{
+		ID:     sessionId,
+		UserID: userId,
+	}
+	active, err := repository.New(s.pool).TouchUserSession(ctx, params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if !active {
+		return errSessionNotFound
+	}
+	return nil
+}
+
+type userSessionRs struct {
+	id         uuid.UUID
+	ip         string
+	userAgent  string
+	createdAt  time.Time
+	lastSeenAt time.Time
+}
+
+// listUserSessions list the active sessions of the user, most recently seen first
+func (s *Service) listUserSessions(ctx context.Context, userId *uuid.UUID) ([]userSessionRs, error) {
+	rows, err := repository.New(s.pool).ListUserSessions(ctx, *userId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	sessions := make([]userSessionRs, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, userSessionRs{
+			id:         row.ID,
+			ip:         row.Ip,
+			userAgent:  row.UserAgent,
+			createdAt:  row.CreatedAt,
+			lastSeenAt: row.LastSeenAt,
+		})
+	}
+	return sessions, nil
+}
+
+// revokeUserSession log the user out of one of their sessions. The session is left in the session store until it
+// expires, but it's rejected from then on.
+func (s *Service) revokeUserSession(ctx context.Context, userId *uuid.UUID, sessionId uuid.UUID) error {
+	params := repository.DeleteUserSessionParams{
+		ID:     sessionId,
+		UserID: *userId,
+	}
+	deleted, err := repository.New(s.pool).DeleteUserSession(ctx, params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+	if deleted == 0 {
+		return errSessionNotFound
+	}
+	return nil
+}
+
+// logoutEverywhere revoke every session, API key, refresh token and access token of the user
+func (s *Service) logoutEverywhere(ctx context.Context, userId *uuid.UUID) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	cutoff, err := revokeUserCredentials(ctx, repository.New(tx), *userId, uuid.Nil)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	s.revoked.addCutoff(*userId, cutoff)
+	return nil
+}
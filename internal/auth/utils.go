@@ -5,6 +5,8 @@ import (
 	"golang.org/x/crypto/argon2"
 )
 
+// computeHash the argon2id hash of recovery codes and legacy API keys. Its parameters are not stored with the hash, so
+// they can't be changed without invalidating all of them. Passwords are hashed by hashPassword instead.
 func computeHash(s string, salt []byte) []byte {
 	return argon2.IDKey([]byte(s), salt, 3, 64*1024, 2, 32)
 }
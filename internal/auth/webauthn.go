@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"auth-strategies/internal/config"
+	"auth-strategies/internal/db/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"time"
+)
+
+// webauthnCeremonyTimeout is how long the user has to complete a registration or login with their authenticator
+const webauthnCeremonyTimeout = 5 * time.Minute
+
+var (
+	errWebauthnInvalid      = errors.New("invalid webauthn response")
+	errWebauthnCloneWarning = errors.New("webauthn sign count did not increase")
+)
+
+// newWebauthn configure the relying party. Credentials must be discoverable (passkeys), so that the login can start
+// without the user identifying themselves, and must verify the user (PIN, biometrics), as they replace the password.
+func newWebauthn(cfg *config.WebauthnConfig) (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: webauthnCeremonyTimeout}
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.RpId,
+		RPDisplayName: cfg.RpDisplayName,
+		RPOrigins:     cfg.RpOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+}
+
+// webauthnUser a user as seen by the WebAuthn library. The user handle stored in the passkeys is the id of the user,
+// which is random and reveals nothing about them.
+type webauthnUser struct {
+	id          uuid.UUID
+	name        string
+	displayName string
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return u.id[:]
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.name
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.displayName
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func loadWebauthnUser(ctx context.Context, repo *repository.Queries, userId uuid.UUID) (*webauthnUser, error) {
+	account, err := repo.GetUserAccount(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.ListWebauthnCredentials(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &webauthnUser{
+		id:          userId,
+		name:        account.Email,
+		displayName: account.FirstName + " " + account.LastName,
+		credentials: make([]webauthn.Credential, 0, len(rows)),
+	}
+	for _, row := range rows {
+		user.credentials = append(user.credentials, credentialFromRow(row))
+	}
+	return user, nil
+}
+
+func credentialFromRow(row repository.WebauthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(row.Transports))
+	for _, transport := range row.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(transport))
+	}
+
+	return webauthn.Credential{
+		ID:              row.CredentialID,
+		PublicKey:       row.PublicKey,
+		AttestationType: row.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: row.BackupEligible,
+			BackupState:    row.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:     row.Aaguid,
+			SignCount:  uint32(row.SignCount),
+			Attachment: protocol.AuthenticatorAttachment(row.Attachment),
+		},
+	}
+}
+
+func credentialParams(userId uuid.UUID, name string, credential *webauthn.Credential) repository.CreateWebauthnCredentialParams {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return repository.CreateWebauthnCredentialParams{
+		UserID:          userId,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		Aaguid:          credential.Authenticator.AAGUID,
+		Attachment:      string(credential.Authenticator.Attachment),
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	}
+}
+
+// beginWebauthnRegistration start registering a new passkey for the user. The returned options are passed to
+// navigator.credentials.create() in the browser, the session data has to be kept until the registration is finished.
+func (s *Service) beginWebauthnRegistration(ctx context.Context, userId *uuid.UUID) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	repo := repository.New(s.pool)
+	user, err := loadWebauthnUser(ctx, repo, *userId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	// Prevent registering the same authenticator twice
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := s.webauthn.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin webauthn registration: %w", err)
+	}
+	return creation, session, nil
+}
+
+// finishWebauthnRegistration verify the response of the authenticator and store the new passkey of the user
+func (s *Service) finishWebauthnRegistration(ctx context.Context, userId *uuid.UUID, name string, session *webauthn.SessionData, response *protocol.ParsedCredentialCreationData) error {
+	repo := repository.New(s.pool)
+	user, err := loadWebauthnUser(ctx, repo, *userId)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDb, err)
+	}
+
+	credential, err := s.webauthn.CreateCredential(user, *session, response)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errWebauthnInvalid, err)
+	}
+
+	if err := repo.CreateWebauthnCredential(ctx, credentialParams(*userId, name, credential)); err != nil {
+		return fmt.Errorf("failed to create webauthn credential: %w", err)
+	}
+	return nil
+}
+
+// beginWebauthnLogin start a passwordless login. Any passkey registered with us may answer, the user is identified
+// by the passkey itself.
+func (s *Service) beginWebauthnLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin webauthn login: %w", err)
+	}
+	return assertion, session, nil
+}
+
+// finishWebauthnLogin verify the response of the authenticator, return the id of the user the passkey belongs to
+func (s *Service) finishWebauthnLogin(ctx context.Context, session *webauthn.SessionData, response *protocol.ParsedCredentialAssertionData) (*uuid.UUID, error) {
+	repo := repository.New(s.pool)
+
+	user, credential, err := s.validateWebauthnLogin(session, response, func(userHandle []byte) (*webauthnUser, error) {
+		userId, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, sql.ErrNoRows
+		}
+		return loadWebauthnUser(ctx, repo, userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	params := repository.UpdateWebauthnCredentialUseParams{
+		CredentialID: credential.ID,
+		SignCount:    int64(credential.Authenticator.SignCount),
+		BackupState:  credential.Flags.BackupState,
+	}
+	if err := repo.UpdateWebauthnCredentialUse(ctx, params); err != nil {
+		return nil, fmt.Errorf("failed to update webauthn credential: %w", err)
+	}
+
+	return &user.id, nil
+}
+
+// validateWebauthnLogin verify an assertion against the passkeys of the user loadUser finds for the user handle of
+// the response. loadUser returns sql.ErrNoRows for unknown user handles.
+//
+// Authenticators that keep a signature counter increase it on every use. A counter that did not increase means the
+// private key was cloned and the copy has been used, so the login is rejected. Passkeys synced between devices
+// always report 0 and are exempt.
+func (s *Service) validateWebauthnLogin(session *webauthn.SessionData, response *protocol.ParsedCredentialAssertionData, loadUser func([]byte) (*webauthnUser, error)) (*webauthnUser, *webauthn.Credential, error) {
+	var user *webauthnUser
+	var loadErr error
+	handler := func(_, userHandle []byte) (webauthn.User, error) {
+		user, loadErr = loadUser(userHandle)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return user, nil
+	}
+
+	_, credential, err := s.webauthn.ValidatePasskeyLogin(handler, *session, response)
+	if loadErr != nil && !errors.Is(loadErr, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("%w: %w", errDb, loadErr)
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errWebauthnInvalid, err)
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, nil, errWebauthnCloneWarning
+	}
+
+	return user, credential, nil
+}
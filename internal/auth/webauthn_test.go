@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"auth-strategies/internal/config"
+	"auth-strategies/internal/db/repository"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"testing"
+)
+
+const (
+	testRpId   = "localhost"
+	testOrigin = "http://localhost:8080"
+)
+
+// softwareAuthenticator a passkey authenticator holding a single ES256 credential in memory, producing the same
+// responses a browser would return from navigator.credentials.create() and navigator.credentials.get().
+type softwareAuthenticator struct {
+	credentialId []byte
+	key          *ecdsa.PrivateKey
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialId := make([]byte, 16)
+	rand.Read(credentialId)
+	return &softwareAuthenticator{credentialId: credentialId, key: key}
+}
+
+// authenticatorData lay out the authenticator data (WebAuthn §6.1): RP id hash, flags, signature counter and, on
+// registration, the attested credential data
+func (a *softwareAuthenticator) authenticatorData(flags protocol.AuthenticatorFlags, attestedCredentialData []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(testRpId))
+	data := append(rpIdHash[:], byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attestedCredentialData...)
+}
+
+func (a *softwareAuthenticator) clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	clientData, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientData
+}
+
+// create register the credential, return the PublicKeyCredential with a "none" attestation
+func (a *softwareAuthenticator) create(t *testing.T, creation *protocol.CredentialCreation) []byte {
+	userHandle, ok := creation.Response.User.ID.(protocol.URLEncodedBase64)
+	if !ok {
+		t.Fatalf("unexpected user handle type %T", creation.Response.User.ID)
+	}
+	a.userHandle = userHandle
+
+	point, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed := point.Bytes()
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: uncompressed[1:33],
+		YCoord: uncompressed[33:],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestedCredentialData := make([]byte, 16) // AAGUID
+	attestedCredentialData = binary.BigEndian.AppendUint16(attestedCredentialData, uint16(len(a.credentialId)))
+	attestedCredentialData = append(attestedCredentialData, a.credentialId...)
+	attestedCredentialData = append(attestedCredentialData, publicKey...)
+
+	flags := protocol.FlagUserPresent | protocol.FlagUserVerified | protocol.FlagAttestedCredentialData
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(flags, attestedCredentialData),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.response(t, map[string]string{
+		"clientDataJSON":    encode(a.clientData(t, "webauthn.create", creation.Response.Challenge)),
+		"attestationObject": encode(attestationObject),
+	})
+}
+
+// get sign the challenge of a login, return the PublicKeyCredential
+func (a *softwareAuthenticator) get(t *testing.T, assertion *protocol.CredentialAssertion) []byte {
+	a.signCount++
+	authenticatorData := a.authenticatorData(protocol.FlagUserPresent|protocol.FlagUserVerified, nil)
+	clientData := a.clientData(t, "webauthn.get", assertion.Response.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authenticatorData), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.response(t, map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authenticatorData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softwareAuthenticator) response(t *testing.T, response map[string]string) []byte {
+	credential, err := json.Marshal(map[string]any{
+		"id":       encode(a.credentialId),
+		"rawId":    encode(a.credentialId),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credential
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// storedCredential simulate the round trip of a credential through the webauthn_credential table
+func storedCredential(params repository.CreateWebauthnCredentialParams) repository.WebauthnCredential {
+	return repository.WebauthnCredential{
+		UserID:          params.UserID,
+		CredentialID:    params.CredentialID,
+		PublicKey:       params.PublicKey,
+		AttestationType: params.AttestationType,
+		Transports:      params.Transports,
+		Aaguid:          params.Aaguid,
+		Attachment:      params.Attachment,
+		SignCount:       params.SignCount,
+		BackupEligible:  params.BackupEligible,
+		BackupState:     params.BackupState,
+		Name:            params.Name,
+	}
+}
+
+func TestWebauthn(t *testing.T) {
+	wa, err := newWebauthn(&config.WebauthnConfig{RpId: testRpId, RpDisplayName: "Test", RpOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{webauthn: wa}
+
+	user := &webauthnUser{id: uuid.New(), name: "johndoe@example.com", displayName: "John Doe"}
+	authenticator := newSoftwareAuthenticator(t)
+
+	creation, session, err := s.webauthn.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creationResponse, err := protocol.ParseCredentialCreationResponseBytes(authenticator.create(t, creation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := s.webauthn.CreateCredential(user, *session, creationResponse)
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	row := storedCredential(credentialParams(user.id, "laptop", credential))
+	user.credentials = append(user.credentials, credentialFromRow(row))
+
+	loadUser := func(userHandle []byte) (*webauthnUser, error) {
+		if !bytes.Equal(userHandle, user.WebAuthnID()) {
+			return nil, sql.ErrNoRows
+		}
+		return user, nil
+	}
+
+	login := func(t *testing.T) (*webauthnUser, *webauthn.Credential, error) {
+		assertion, session, err := s.beginWebauthnLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertionResponse, err := protocol.ParseCredentialRequestResponseBytes(authenticator.get(t, assertion))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.validateWebauthnLogin(session, assertionResponse, loadUser)
+	}
+
+	t.Run("login", func(t *testing.T) {
+		for want := uint32(1); want <= 2; want++ {
+			loggedIn, credential, err := login(t)
+			if err != nil {
+				t.Fatalf("login failed: %v", err)
+			}
+			if loggedIn.id != user.id {
+				t.Fatalf("logged in as %s, want %s", loggedIn.id, user.id)
+			}
+			if credential.Authenticator.SignCount != want {
+				t.Fatalf("sign count %d, want %d", credential.Authenticator.SignCount, want)
+			}
+			user.credentials[0].Authenticator.SignCount = credential.Authenticator.SignCount
+		}
+	})
+
+	t.Run("cloned authenticator", func(t *testing.T) {
+		clone := *authenticator
+		clone.signCount = 0
+		original := authenticator
+		authenticator = &clone
+		defer func() { authenticator = original }()
+
+		if _, _, err := login(t); !errors.Is(err, errWebauthnCloneWarning) {
+			t.Fatalf("got %v, want %v", err, errWebauthnCloneWarning)
+		}
+	})
+
+	t.Run("replayed assertion", func(t *testing.T) {
+		assertion, _, err := s.beginWebauthnLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := authenticator.get(t, assertion)
+
+		_, otherSession, err := s.beginWebauthnLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertionResponse, err := protocol.ParseCredentialRequestResponseBytes(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.validateWebauthnLogin(otherSession, assertionResponse, loadUser); !errors.Is(err, errWebauthnInvalid) {
+			t.Fatalf("got %v, want %v", err, errWebauthnInvalid)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		original := authenticator.userHandle
+		unknown := uuid.New()
+		authenticator.userHandle = unknown[:]
+		defer func() { authenticator.userHandle = original }()
+
+		if _, _, err := login(t); !errors.Is(err, errWebauthnInvalid) {
+			t.Fatalf("got %v, want %v", err, errWebauthnInvalid)
+		}
+	})
+}
@@ -24,5 +24,5 @@ type SuccessResponse struct {
 
 // ErrorResponse generic HTTP response returned in an error-case, contains an error message
 type ErrorResponse struct {
-	Error string `json:"error" example:"error""`
+	Error string `json:"error" example:"error"`
 }
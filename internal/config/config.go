@@ -6,16 +6,164 @@ import (
 	"github.com/rs/zerolog/log"
 	"io"
 	"os"
+	"time"
 )
 
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	Db     DbConfig     `yaml:"db"`
+	Server    ServerConfig    `yaml:"server"`
+	Db        DbConfig        `yaml:"db"`
+	Token     TokenConfig     `yaml:"token"`
+	ApiKey    ApiKeyConfig    `yaml:"apiKey"`
+	Mfa       MfaConfig       `yaml:"mfa"`
+	Webauthn  WebauthnConfig  `yaml:"webauthn"`
+	Email     EmailConfig     `yaml:"email"`
+	Mail      MailConfig      `yaml:"mail"`
+	MagicLink MagicLinkConfig `yaml:"magicLink"`
+	Lockout   LockoutConfig   `yaml:"lockout"`
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+	Hashing   HashingConfig   `yaml:"hashing"`
+	Password  PasswordConfig  `yaml:"password"`
 }
 
 type ServerConfig struct {
 	Port       int    `yaml:"port"`
 	HmacSecret string `yaml:"hmacSecret"`
+	// PublicUrl is the URL the server is reachable on from the outside, links sent to users point there
+	PublicUrl string `yaml:"publicUrl"`
+	// AdminAddr is the address of the internal listener serving metrics, empty disables it
+	AdminAddr string `yaml:"adminAddr"`
+}
+
+// TokenConfig signing keys of JWT access tokens. The key from PrivateKeyFile is used whenever no key of the key ring
+// stored in the database is active, and is accepted until the tokens it signed expire. If PrivateKeyFile is empty, HS256
+// with ServerConfig.HmacSecret is used instead.
+type TokenConfig struct {
+	PrivateKeyFile     string        `yaml:"privateKeyFile"`
+	KeyId              string        `yaml:"keyId"`
+	KeyRefreshInterval time.Duration `yaml:"keyRefreshInterval"`
+	// RevocationSyncInterval is how often revoked tokens are synced between server instances
+	RevocationSyncInterval time.Duration `yaml:"revocationSyncInterval"`
+}
+
+type ApiKeyConfig struct {
+	// HashKey is the HMAC key API key secrets are hashed with
+	HashKey string `yaml:"hashKey"`
+	// RotationGracePeriod is how long a rotated API key remains valid next to its successor
+	RotationGracePeriod time.Duration `yaml:"rotationGracePeriod"`
+}
+
+type MfaConfig struct {
+	// Issuer is the name authenticator apps list TOTP secrets under
+	Issuer string `yaml:"issuer"`
+}
+
+// WebauthnConfig the relying party passkeys are registered with. Browsers only offer a passkey on pages served from
+// one of the origins, whose host must be RpId or a subdomain of it.
+type WebauthnConfig struct {
+	RpId          string   `yaml:"rpId"`
+	RpDisplayName string   `yaml:"rpDisplayName"`
+	RpOrigins     []string `yaml:"rpOrigins"`
+}
+
+type EmailConfig struct {
+	// RequireVerified whether users have to verify their email address before they can log in with their password
+	RequireVerified bool `yaml:"requireVerified"`
+}
+
+type MagicLinkConfig struct {
+	// SelfRegistration whether requesting a magic link for an unknown email address creates an account for it
+	SelfRegistration bool `yaml:"selfRegistration"`
+}
+
+// LockoutConfig throttling of password logins. Failed logins are counted per email address and per IP address, and
+// either is locked out once its count reaches its threshold. Wrong second factors are counted per user against
+// MfaThreshold. The first lockout lasts BaseDuration, every further failure doubles it, up to MaxDuration.
+type LockoutConfig struct {
+	AccountThreshold int           `yaml:"accountThreshold"`
+	IpThreshold      int           `yaml:"ipThreshold"`
+	MfaThreshold     int           `yaml:"mfaThreshold"`
+	BaseDuration     time.Duration `yaml:"baseDuration"`
+	MaxDuration      time.Duration `yaml:"maxDuration"`
+	// FailureWindow is how long failures are remembered, counting starts over after a window without any
+	FailureWindow time.Duration `yaml:"failureWindow"`
+}
+
+// RateLimitConfig request rate limits. Backend is either "memory", or "postgres" to share the limits between server
+// instances.
+type RateLimitConfig struct {
+	Backend string `yaml:"backend"`
+	// Ip limits every request per client IP address
+	Ip RateLimit `yaml:"ip"`
+	// Credentials limits the requests checking a password, token or code per client IP address, on top of Ip
+	Credentials RateLimit `yaml:"credentials"`
+	// User limits authenticated requests per user
+	User RateLimit `yaml:"user"`
+	// ApiKey limits requests authenticated by an API key per key, instead of User
+	ApiKey RateLimit `yaml:"apiKey"`
+}
+
+// RateLimit a token bucket, allowing bursts of up to Burst requests and refilling at Burst requests per Period. A zero
+// Burst disables the limit.
+type RateLimit struct {
+	Burst  int           `yaml:"burst"`
+	Period time.Duration `yaml:"period"`
+}
+
+// HashingConfig password hashing. Each argon2 computation allocates Argon2.Memory KiB, so at most MaxConcurrent of them
+// run at once, 0 meaning one per CPU. Up to MaxQueue more wait for a free slot, for at most MaxWait or until their
+// request is cancelled, anything beyond that is rejected.
+type HashingConfig struct {
+	MaxConcurrent int           `yaml:"maxConcurrent"`
+	MaxQueue      int           `yaml:"maxQueue"`
+	MaxWait       time.Duration `yaml:"maxWait"`
+	// Argon2 is used for new password hashes. Hashes are stored along with their parameters, those computed with
+	// different ones are upgraded on the next login of their user.
+	Argon2 Argon2Config `yaml:"argon2"`
+}
+
+// Argon2Config argon2id parameters, see RFC 9106 for choosing them
+type Argon2Config struct {
+	Time uint32 `yaml:"time"`
+	// Memory in KiB
+	Memory     uint32 `yaml:"memory"`
+	Threads    uint8  `yaml:"threads"`
+	KeyLength  uint32 `yaml:"keyLength"`
+	SaltLength uint32 `yaml:"saltLength"`
+}
+
+// PasswordConfig the policy new passwords have to satisfy on registration, password change and reset
+type PasswordConfig struct {
+	// MinLength and MaxLength in characters, after normalization
+	MinLength int `yaml:"minLength"`
+	MaxLength int `yaml:"maxLength"`
+	// Normalize apply Unicode NFKC normalization to passwords before hashing them, so that the different ways of typing
+	// the same characters are the same password
+	Normalize bool `yaml:"normalize"`
+	// BannedWords may not appear in passwords, case-insensitively. The name and email address of the user are always
+	// banned.
+	BannedWords []string `yaml:"bannedWords"`
+	// BreachedPasswordsFile lists the SHA-1 hashes of breached passwords that are rejected, in the format of the
+	// Pwned Passwords downloads: one hash per line in hex, optionally followed by a colon and a count. Empty disables
+	// the check.
+	BreachedPasswordsFile string `yaml:"breachedPasswordsFile"`
+}
+
+// MailConfig outbound email. Backend is either "smtp", "file" to write every mail into Dir as an .eml file, or
+// "stdout".
+type MailConfig struct {
+	Backend string     `yaml:"backend"`
+	From    string     `yaml:"from"`
+	Dir     string     `yaml:"dir"`
+	Smtp    SmtpConfig `yaml:"smtp"`
+	// PollInterval is how often the outbox is checked for mails to send
+	PollInterval time.Duration `yaml:"pollInterval"`
+}
+
+type SmtpConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
 }
 
 type DbConfig struct {
@@ -32,6 +180,14 @@ func ParseConfig() Config {
 	if dbHostFromEnv != "" {
 		cfg.Db.Host = dbHostFromEnv
 	}
+	privateKeyFileFromEnv := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	if privateKeyFileFromEnv != "" {
+		cfg.Token.PrivateKeyFile = privateKeyFileFromEnv
+	}
+	smtpPasswordFromEnv := os.Getenv("SMTP_PASSWORD")
+	if smtpPasswordFromEnv != "" {
+		cfg.Mail.Smtp.Password = smtpPasswordFromEnv
+	}
 	return cfg
 }
 
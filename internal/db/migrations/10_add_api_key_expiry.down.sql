@@ -0,0 +1,3 @@
+ALTER TABLE api_key
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS rotated_at;
\ No newline at end of file
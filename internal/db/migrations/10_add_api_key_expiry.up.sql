@@ -0,0 +1,3 @@
+ALTER TABLE api_key
+    ADD COLUMN expires_at TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN rotated_at TIMESTAMPTZ DEFAULT NULL;
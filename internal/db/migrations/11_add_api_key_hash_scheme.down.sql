@@ -0,0 +1 @@
+ALTER TABLE api_key DROP COLUMN IF EXISTS hash_scheme;
\ No newline at end of file
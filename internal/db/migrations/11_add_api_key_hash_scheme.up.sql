@@ -0,0 +1 @@
+ALTER TABLE api_key ADD COLUMN hash_scheme TEXT NOT NULL DEFAULT 'argon2id';
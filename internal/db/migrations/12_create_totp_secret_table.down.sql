@@ -0,0 +1 @@
+DROP TABLE IF EXISTS totp_secret;
\ No newline at end of file
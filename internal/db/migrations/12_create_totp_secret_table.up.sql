@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS totp_secret (
+    user_id UUID PRIMARY KEY REFERENCES user_account(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    confirmed_at TIMESTAMPTZ DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS mfa_challenge (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES user_account(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL UNIQUE,
+    mode TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX mfa_challenge_expires_idx ON mfa_challenge (expires_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS recovery_code (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES user_account(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    code_salt BYTEA NOT NULL,
+    used_at TIMESTAMPTZ DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX recovery_code_user_idx ON recovery_code (user_id);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS webauthn_credential;
\ No newline at end of file
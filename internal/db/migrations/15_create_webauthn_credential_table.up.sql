@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS webauthn_credential (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES user_account(id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    attestation_type TEXT NOT NULL,
+    transports TEXT[] NOT NULL DEFAULT '{}',
+    aaguid BYTEA NOT NULL,
+    attachment TEXT NOT NULL,
+    sign_count BIGINT NOT NULL,
+    backup_eligible BOOLEAN NOT NULL,
+    backup_state BOOLEAN NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    last_used_at TIMESTAMPTZ DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX webauthn_credential_user_idx ON webauthn_credential (user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS one_time_token (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES user_account(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    token_hash BYTEA NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX one_time_token_user_idx ON one_time_token (user_id, purpose);
+CREATE INDEX one_time_token_expires_idx ON one_time_token (expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE user_account ADD COLUMN email_verified_at TIMESTAMPTZ DEFAULT NULL;
+
+-- Accounts registered before verification existed can't be locked out retroactively
+UPDATE user_account SET email_verified_at=COALESCE(created_at, CURRENT_TIMESTAMP);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS login_failure;
\ No newline at end of file
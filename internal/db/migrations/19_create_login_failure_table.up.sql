@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS login_failure (
+    kind TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ DEFAULT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, subject)
+);
+
+CREATE INDEX login_failure_last_failure_idx ON login_failure (last_failure_at);
@@ -0,0 +1,12 @@
+ALTER TABLE password_auth RENAME COLUMN pw_hash TO pw_phc;
+ALTER TABLE password_auth ADD COLUMN pw_hash BYTEA NOT NULL DEFAULT '', ADD COLUMN pw_salt BYTEA NOT NULL DEFAULT '';
+
+-- Only hashes with the former hard-coded parameters can be converted back, users with any other hash have to reset
+-- their password
+UPDATE password_auth SET
+    pw_salt=decode(rpad(split_part(pw_phc, '$', 5), (length(split_part(pw_phc, '$', 5)) + 3) / 4 * 4, '='), 'base64'),
+    pw_hash=decode(rpad(split_part(pw_phc, '$', 6), (length(split_part(pw_phc, '$', 6)) + 3) / 4 * 4, '='), 'base64')
+WHERE pw_phc LIKE '$argon2id$v=19$m=65536,t=3,p=2$%';
+
+ALTER TABLE password_auth ALTER COLUMN pw_hash DROP DEFAULT, ALTER COLUMN pw_salt DROP DEFAULT;
+ALTER TABLE password_auth DROP COLUMN pw_phc;
\ No newline at end of file
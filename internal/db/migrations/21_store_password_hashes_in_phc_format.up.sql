@@ -0,0 +1,10 @@
+ALTER TABLE password_auth ADD COLUMN pw_phc TEXT;
+
+-- Hashes so far were all computed with the same hard-coded argon2 parameters, stored separately from the hash
+UPDATE password_auth SET pw_phc='$argon2id$v=19$m=65536,t=3,p=2$'
+    || rtrim(encode(pw_salt, 'base64'), '=') || '$' || rtrim(encode(pw_hash, 'base64'), '=');
+
+ALTER TABLE password_auth ALTER COLUMN pw_phc SET NOT NULL;
+ALTER TABLE password_auth DROP COLUMN pw_hash;
+ALTER TABLE password_auth DROP COLUMN pw_salt;
+ALTER TABLE password_auth RENAME COLUMN pw_phc TO pw_hash;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS token_cutoff;
\ No newline at end of file
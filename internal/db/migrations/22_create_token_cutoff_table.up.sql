@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS token_cutoff (
+    user_id UUID PRIMARY KEY REFERENCES user_account(id) ON DELETE CASCADE,
+    -- Access tokens of the user issued up to this point are revoked
+    revoked_before TIMESTAMPTZ NOT NULL,
+    -- All of those tokens have expired by then, so the cutoff can be deleted
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX token_cutoff_expires_at_idx ON token_cutoff (expires_at);
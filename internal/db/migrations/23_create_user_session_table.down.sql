@@ -0,0 +1 @@
+DROP TABLE IF EXISTS user_session;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- Metadata of the sessions in the sessions table, which keeps them as opaque blobs. A session is only accepted while
+-- its row exists, so deleting the row revokes the session.
+CREATE TABLE IF NOT EXISTS user_session (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES user_account(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX user_session_user_id_idx ON user_session (user_id);
+CREATE INDEX user_session_expires_at_idx ON user_session (expires_at);
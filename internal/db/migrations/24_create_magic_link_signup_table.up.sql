@@ -0,0 +1,14 @@
+-- Magic links requested for unknown email addresses under self-registration. The account is only created once the link
+-- is used, so requesting links for addresses of others leaves no accounts behind.
+CREATE TABLE IF NOT EXISTS magic_link_signup (
+    id SERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    token_hash BYTEA NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX magic_link_signup_email_idx ON magic_link_signup (email);
+CREATE INDEX magic_link_signup_expires_at_idx ON magic_link_signup (expires_at);
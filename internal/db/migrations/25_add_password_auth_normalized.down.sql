@@ -0,0 +1 @@
+ALTER TABLE password_auth DROP COLUMN IF EXISTS pw_normalized;
\ No newline at end of file
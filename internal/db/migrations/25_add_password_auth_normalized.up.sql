@@ -0,0 +1,3 @@
+-- Whether pw_hash is the hash of the normalized (NFKC) password. Hashes stored before normalization existed, and
+-- imported ones, are of the password as it was typed.
+ALTER TABLE password_auth ADD COLUMN IF NOT EXISTS pw_normalized BOOLEAN NOT NULL DEFAULT false;
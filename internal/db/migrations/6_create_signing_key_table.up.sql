@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS signing_key (
+    id SERIAL PRIMARY KEY,
+    kid TEXT NOT NULL UNIQUE,
+    private_key TEXT NOT NULL,
+    activates_at TIMESTAMPTZ NOT NULL,
+    retires_at TIMESTAMPTZ DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS revoked_token (
+    jti UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES user_account(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX revoked_token_expires_at_idx ON revoked_token (expires_at);
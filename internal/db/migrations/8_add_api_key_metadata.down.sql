@@ -0,0 +1,4 @@
+ALTER TABLE api_key
+    DROP COLUMN IF EXISTS name,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS revoked_at;
\ No newline at end of file
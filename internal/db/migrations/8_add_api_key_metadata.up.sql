@@ -0,0 +1,4 @@
+ALTER TABLE api_key
+    ADD COLUMN name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at TIMESTAMPTZ DEFAULT NULL,
+    ADD COLUMN revoked_at TIMESTAMPTZ DEFAULT NULL;
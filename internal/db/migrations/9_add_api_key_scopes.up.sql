@@ -0,0 +1,4 @@
+ALTER TABLE api_key ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{}';
+
+-- Existing keys were granted the full identity of their owner, keep it that way
+UPDATE api_key SET scopes = '{user:read}';
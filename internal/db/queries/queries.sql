@@ -1,8 +1,13 @@
 -- name: GetUserInfo :one
-SELECT first_name, last_name FROM user_account WHERE id=$1;
+SELECT
+    first_name,
+    last_name,
+    (SELECT COUNT(*) FROM recovery_code WHERE user_id=$1 AND used_at IS NULL) AS recovery_codes_remaining
+FROM user_account
+WHERE id=$1;
 
 -- name: GetPasswordAuth :one
-SELECT ua.id, pa.pw_hash, pa.pw_salt
+SELECT ua.id, ua.email_verified_at, pa.pw_hash, pa.pw_normalized
 FROM user_account ua
 JOIN password_auth pa ON pa.user_id = ua.id
 WHERE ua.email=$1;
@@ -19,7 +24,7 @@ SELECT
 INSERT INTO user_account (email, first_name, last_name) VALUES ($1, $2, $3) RETURNING id;
 
 -- name: CreatePasswordAuth :exec
-INSERT INTO password_auth (user_id, pw_hash, pw_salt) VALUES ($1, $2, $3);
+INSERT INTO password_auth (user_id, pw_hash, pw_normalized) VALUES ($1, $2, $3);
 
 -- name: ApiKeyPublicIdTaken :one
 SELECT
@@ -28,10 +33,323 @@ SELECT
     ) THEN true ELSE false END;
 
 -- name: CreateApiKey :exec
-INSERT INTO api_key (user_id, public_id, secret_hash, secret_salt)
-VALUES ($1, $2, $3, $4);
+INSERT INTO api_key (user_id, public_id, secret_hash, secret_salt, hash_scheme, name, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
 
 -- name: FindApiKey :one
-SELECT user_id, public_id, secret_hash, secret_salt
+SELECT id, user_id, public_id, secret_hash, secret_salt, hash_scheme, revoked_at, scopes, expires_at
+FROM api_key
+WHERE public_id=$1;
+
+-- name: UpgradeApiKeyHash :exec
+UPDATE api_key SET secret_hash=$2, secret_salt=$3, hash_scheme=$4, updated_at=CURRENT_TIMESTAMP
+WHERE id=$1;
+
+-- name: FindApiKeyForRotation :one
+SELECT id, name, scopes, created_at, expires_at, rotated_at
+FROM api_key
+WHERE user_id=$1 AND public_id=$2 AND revoked_at IS NULL
+FOR UPDATE;
+
+-- name: MarkApiKeyRotated :exec
+UPDATE api_key SET rotated_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP, expires_at=$2
+WHERE id=$1;
+
+-- name: ListApiKeys :many
+SELECT public_id, name, scopes, created_at, last_used_at, expires_at, rotated_at
 FROM api_key
-WHERE public_id=$1;
\ No newline at end of file
+WHERE user_id=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+ORDER BY created_at;
+
+-- name: RevokeApiKey :execrows
+UPDATE api_key SET revoked_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+WHERE user_id=$1 AND public_id=$2 AND revoked_at IS NULL;
+
+-- name: TouchApiKey :exec
+UPDATE api_key SET last_used_at=CURRENT_TIMESTAMP
+WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute');
+
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_token (user_id, family_id, token_hash, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: FindRefreshTokenForUpdate :one
+SELECT id, user_id, family_id, used_at, revoked_at, expires_at
+FROM refresh_token
+WHERE token_hash=$1
+FOR UPDATE;
+
+-- name: MarkRefreshTokenUsed :exec
+UPDATE refresh_token SET used_at=CURRENT_TIMESTAMP WHERE id=$1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_token SET revoked_at=CURRENT_TIMESTAMP
+WHERE family_id=$1 AND revoked_at IS NULL;
+
+-- name: CreateSigningKey :exec
+INSERT INTO signing_key (kid, private_key, activates_at) VALUES ($1, $2, $3);
+
+-- name: ListSigningKeys :many
+SELECT kid, private_key, activates_at, retires_at
+FROM signing_key
+ORDER BY activates_at, id;
+
+-- name: RetireSigningKey :execrows
+UPDATE signing_key SET retires_at=CURRENT_TIMESTAMP
+WHERE kid=$1 AND (retires_at IS NULL OR retires_at > CURRENT_TIMESTAMP);
+
+-- name: DeleteSigningKey :execrows
+DELETE FROM signing_key WHERE kid=$1;
+
+-- name: CreateRevokedToken :exec
+INSERT INTO revoked_token (jti, user_id, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: ListRevokedTokens :many
+SELECT jti, expires_at FROM revoked_token WHERE expires_at > CURRENT_TIMESTAMP;
+
+-- name: DeleteExpiredRevokedTokens :execrows
+DELETE FROM revoked_token WHERE expires_at <= CURRENT_TIMESTAMP;
+
+-- name: FindRefreshToken :one
+SELECT user_id, family_id FROM refresh_token WHERE token_hash=$1;
+
+-- name: GetUserEmail :one
+SELECT email FROM user_account WHERE id=$1;
+
+-- name: CreateTotpSecret :execrows
+INSERT INTO totp_secret (user_id, secret) VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret, created_at=CURRENT_TIMESTAMP
+WHERE totp_secret.confirmed_at IS NULL;
+
+-- name: FindTotpSecret :one
+SELECT secret, last_used_step, confirmed_at FROM totp_secret WHERE user_id=$1;
+
+-- name: FindTotpSecretForUpdate :one
+SELECT secret, last_used_step, confirmed_at FROM totp_secret WHERE user_id=$1 FOR UPDATE;
+
+-- name: ConfirmTotpSecret :exec
+UPDATE totp_secret SET confirmed_at=CURRENT_TIMESTAMP, last_used_step=$2 WHERE user_id=$1;
+
+-- name: MarkTotpStepUsed :exec
+UPDATE totp_secret SET last_used_step=$2 WHERE user_id=$1;
+
+-- name: MfaEnabled :one
+SELECT
+    CASE WHEN EXISTS (
+        SELECT 1 FROM totp_secret WHERE user_id=$1 AND confirmed_at IS NOT NULL
+    ) THEN true ELSE false END;
+
+-- name: CreateMfaChallenge :exec
+INSERT INTO mfa_challenge (user_id, token_hash, mode, expires_at) VALUES ($1, $2, $3, $4);
+
+-- name: FindMfaChallengeUser :one
+SELECT user_id FROM mfa_challenge WHERE token_hash=$1 AND expires_at > CURRENT_TIMESTAMP;
+
+-- name: FindMfaChallengeForUpdate :one
+SELECT id, user_id, mode, attempts, expires_at
+FROM mfa_challenge
+WHERE token_hash=$1
+FOR UPDATE;
+
+-- name: IncrementMfaChallengeAttempts :exec
+UPDATE mfa_challenge SET attempts=attempts+1 WHERE id=$1;
+
+-- name: DeleteMfaChallenge :exec
+DELETE FROM mfa_challenge WHERE id=$1;
+
+-- name: DeleteExpiredMfaChallenges :exec
+DELETE FROM mfa_challenge WHERE expires_at <= CURRENT_TIMESTAMP;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_code (user_id, code_hash, code_salt) VALUES ($1, $2, $3);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_code WHERE user_id=$1;
+
+-- name: ListUnusedRecoveryCodeSalts :many
+SELECT DISTINCT code_salt FROM recovery_code WHERE user_id=$1 AND used_at IS NULL;
+
+-- name: ListUnusedRecoveryCodesForUpdate :many
+SELECT id, code_hash, code_salt
+FROM recovery_code
+WHERE user_id=$1 AND used_at IS NULL
+FOR UPDATE;
+
+-- name: MarkRecoveryCodeUsed :exec
+UPDATE recovery_code SET used_at=CURRENT_TIMESTAMP WHERE id=$1;
+
+-- name: GetUserAccount :one
+SELECT email, first_name, last_name FROM user_account WHERE id=$1;
+
+-- name: CreateWebauthnCredential :exec
+INSERT INTO webauthn_credential (
+    user_id, credential_id, public_key, attestation_type, transports, aaguid, attachment, sign_count,
+    backup_eligible, backup_state, name
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+
+-- name: ListWebauthnCredentials :many
+SELECT * FROM webauthn_credential WHERE user_id=$1 ORDER BY created_at;
+
+-- name: UpdateWebauthnCredentialUse :exec
+UPDATE webauthn_credential SET sign_count=$2, backup_state=$3, last_used_at=CURRENT_TIMESTAMP
+WHERE credential_id=$1;
+
+-- name: FindUserIdByEmail :one
+SELECT id FROM user_account WHERE email=$1;
+
+-- name: CreateOneTimeToken :exec
+INSERT INTO one_time_token (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4);
+
+-- name: ConsumeOneTimeToken :one
+DELETE FROM one_time_token
+WHERE token_hash=$1 AND purpose=$2 AND expires_at > CURRENT_TIMESTAMP
+RETURNING user_id;
+
+-- name: FindOneTimeToken :one
+SELECT user_id FROM one_time_token WHERE token_hash=$1 AND purpose=$2 AND expires_at > CURRENT_TIMESTAMP;
+
+-- name: DeleteOneTimeTokens :exec
+DELETE FROM one_time_token WHERE user_id=$1 AND purpose=$2;
+
+-- name: DeleteExpiredOneTimeTokens :exec
+DELETE FROM one_time_token WHERE expires_at <= CURRENT_TIMESTAMP;
+
+-- name: CreateMagicLinkSignup :exec
+INSERT INTO magic_link_signup (email, first_name, last_name, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeMagicLinkSignup :one
+DELETE FROM magic_link_signup
+WHERE token_hash=$1 AND expires_at > CURRENT_TIMESTAMP
+RETURNING email, first_name, last_name;
+
+-- name: DeleteMagicLinkSignups :exec
+DELETE FROM magic_link_signup WHERE email=$1;
+
+-- name: DeleteExpiredMagicLinkSignups :exec
+DELETE FROM magic_link_signup WHERE expires_at <= CURRENT_TIMESTAMP;
+
+-- name: SetPasswordAuth :exec
+INSERT INTO password_auth (user_id, pw_hash, pw_normalized) VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE SET pw_hash=EXCLUDED.pw_hash, pw_normalized=EXCLUDED.pw_normalized;
+
+-- name: ReplacePasswordHash :execrows
+UPDATE password_auth SET pw_hash=sqlc.arg(new_hash), pw_normalized=sqlc.arg(pw_normalized)
+WHERE user_id=sqlc.arg(user_id) AND pw_hash=sqlc.arg(old_hash);
+
+-- name: DeleteMfaChallenges :exec
+DELETE FROM mfa_challenge WHERE user_id=$1;
+
+-- name: RevokeAllApiKeys :exec
+UPDATE api_key SET revoked_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+WHERE user_id=$1 AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokens :exec
+UPDATE refresh_token SET revoked_at=CURRENT_TIMESTAMP
+WHERE user_id=$1 AND revoked_at IS NULL;
+
+-- name: FindUserEmailVerification :one
+SELECT id, email_verified_at FROM user_account WHERE email=$1;
+
+-- name: DeleteUnverifiedPasswordAuth :exec
+DELETE FROM password_auth pa USING user_account ua
+WHERE pa.user_id=$1 AND ua.id=pa.user_id AND ua.email_verified_at IS NULL;
+
+-- name: MarkEmailVerified :exec
+UPDATE user_account SET email_verified_at=CURRENT_TIMESTAMP WHERE id=$1 AND email_verified_at IS NULL;
+
+-- name: LastOneTimeTokenCreatedAt :one
+SELECT created_at FROM one_time_token WHERE user_id=$1 AND purpose=$2 ORDER BY created_at DESC LIMIT 1;
+
+-- name: EnqueueMail :exec
+INSERT INTO mail_outbox (recipient, subject, text_body, html_body) VALUES ($1, $2, $3, $4);
+
+-- name: ListDueMailForUpdate :many
+SELECT id, recipient, subject, text_body, html_body, attempts
+FROM mail_outbox
+WHERE next_attempt_at <= CURRENT_TIMESTAMP
+ORDER BY next_attempt_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: DeleteMail :exec
+DELETE FROM mail_outbox WHERE id=$1;
+
+-- name: RecordMailFailure :exec
+UPDATE mail_outbox SET attempts=attempts+1, last_error=$2, next_attempt_at=$3 WHERE id=$1;
+
+-- name: ListLoginLocks :many
+SELECT locked_until
+FROM login_failure
+WHERE ((kind='account' AND subject=sqlc.arg(email)) OR (kind='ip' AND subject=sqlc.arg(ip)))
+    AND locked_until > CURRENT_TIMESTAMP;
+
+-- name: FindLoginLock :one
+SELECT locked_until FROM login_failure WHERE kind=$1 AND subject=$2 AND locked_until > CURRENT_TIMESTAMP;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failure (kind, subject, failures) VALUES ($1, $2, 1)
+ON CONFLICT (kind, subject) DO UPDATE SET
+    failures=CASE WHEN login_failure.last_failure_at < sqlc.arg(window_start) THEN 1 ELSE login_failure.failures + 1 END,
+    last_failure_at=CURRENT_TIMESTAMP
+RETURNING failures;
+
+-- name: LockLogin :exec
+UPDATE login_failure SET locked_until=$3 WHERE kind=$1 AND subject=$2;
+
+-- name: ClearLoginFailures :execrows
+DELETE FROM login_failure WHERE kind=$1 AND subject=$2;
+
+-- name: DeleteStaleLoginFailures :exec
+DELETE FROM login_failure
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP);
+
+-- name: FindRateLimitBucketForUpdate :one
+SELECT tokens, updated_at FROM rate_limit_bucket WHERE key=$1 FOR UPDATE;
+
+-- name: SetRateLimitBucket :exec
+INSERT INTO rate_limit_bucket (key, tokens, updated_at) VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE SET tokens=EXCLUDED.tokens, updated_at=EXCLUDED.updated_at;
+
+-- name: DeleteIdleRateLimitBuckets :exec
+DELETE FROM rate_limit_bucket WHERE updated_at < $1;
+
+-- name: GetPasswordHash :one
+SELECT pw_hash, pw_normalized FROM password_auth WHERE user_id=$1;
+
+-- name: SetTokenCutoff :exec
+INSERT INTO token_cutoff (user_id, revoked_before, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE SET revoked_before=EXCLUDED.revoked_before, expires_at=EXCLUDED.expires_at;
+
+-- name: ListTokenCutoffs :many
+SELECT user_id, revoked_before, expires_at FROM token_cutoff WHERE expires_at > CURRENT_TIMESTAMP;
+
+-- name: DeleteExpiredTokenCutoffs :execrows
+DELETE FROM token_cutoff WHERE expires_at <= CURRENT_TIMESTAMP;
+
+-- name: CreateUserSession :one
+INSERT INTO user_session (user_id, ip, user_agent, expires_at) VALUES ($1, $2, $3, $4) RETURNING id;
+
+-- name: TouchUserSession :one
+WITH active AS (
+    SELECT id FROM user_session WHERE id=$1 AND user_id=$2 AND expires_at > CURRENT_TIMESTAMP
+), touched AS (
+    UPDATE user_session SET last_seen_at = CURRENT_TIMESTAMP
+    WHERE id IN (SELECT id FROM active) AND last_seen_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'
+)
+SELECT EXISTS (SELECT 1 FROM active) AS active;
+
+-- name: ListUserSessions :many
+SELECT id, ip, user_agent, created_at, last_seen_at FROM user_session
+WHERE user_id=$1 AND expires_at > CURRENT_TIMESTAMP
+ORDER BY last_seen_at DESC;
+
+-- name: DeleteUserSession :execrows
+DELETE FROM user_session WHERE id=$1 AND user_id=$2;
+
+-- name: DeleteOtherUserSessions :exec
+DELETE FROM user_session WHERE user_id=$1 AND id <> $2;
+
+-- name: DeleteExpiredUserSessions :exec
+DELETE FROM user_session WHERE expires_at <= CURRENT_TIMESTAMP;
@@ -18,13 +18,102 @@ type ApiKey struct {
 	SecretSalt []byte
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+	Name       string
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	Scopes     []string
+	ExpiresAt  *time.Time
+	RotatedAt  *time.Time
+	HashScheme string
+}
+
+type LoginFailure struct {
+	Kind          string
+	Subject       string
+	Failures      int32
+	LockedUntil   *time.Time
+	LastFailureAt time.Time
+}
+
+type MagicLinkSignup struct {
+	ID        int32
+	Email     string
+	FirstName string
+	LastName  string
+	TokenHash []byte
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type MailOutbox struct {
+	ID            int32
+	Recipient     string
+	Subject       string
+	TextBody      string
+	HtmlBody      string
+	Attempts      int32
+	NextAttemptAt *time.Time
+	LastError     string
+	CreatedAt     time.Time
+}
+
+type MfaChallenge struct {
+	ID        int32
+	UserID    uuid.UUID
+	TokenHash []byte
+	Mode      string
+	Attempts  int32
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type OneTimeToken struct {
+	ID        int32
+	UserID    uuid.UUID
+	Purpose   string
+	TokenHash []byte
+	ExpiresAt time.Time
+	CreatedAt time.Time
 }
 
 type PasswordAuth struct {
-	ID     int32
-	UserID uuid.UUID
-	PwHash []byte
-	PwSalt []byte
+	ID           int32
+	UserID       uuid.UUID
+	PwHash       string
+	PwNormalized bool
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        int32
+	UserID    uuid.UUID
+	CodeHash  []byte
+	CodeSalt  []byte
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type RefreshToken struct {
+	ID        int32
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash []byte
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type RevokedToken struct {
+	Jti       uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt time.Time
 }
 
 type Session struct {
@@ -33,12 +122,63 @@ type Session struct {
 	Expiry time.Time
 }
 
+type SigningKey struct {
+	ID          int32
+	Kid         string
+	PrivateKey  string
+	ActivatesAt time.Time
+	RetiresAt   *time.Time
+	CreatedAt   time.Time
+}
+
+type TokenCutoff struct {
+	UserID        uuid.UUID
+	RevokedBefore time.Time
+	ExpiresAt     time.Time
+}
+
+type TotpSecret struct {
+	UserID       uuid.UUID
+	Secret       string
+	LastUsedStep int64
+	ConfirmedAt  *time.Time
+	CreatedAt    time.Time
+}
+
 type UserAccount struct {
-	ID        uuid.UUID
-	Email     string
-	FirstName string
-	LastName  string
-	CreatedAt *time.Time
-	UpdatedAt *time.Time
-	DeletedAt *time.Time
+	ID              uuid.UUID
+	Email           string
+	FirstName       string
+	LastName        string
+	CreatedAt       *time.Time
+	UpdatedAt       *time.Time
+	DeletedAt       *time.Time
+	EmailVerifiedAt *time.Time
+}
+
+type UserSession struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Ip         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+type WebauthnCredential struct {
+	ID              int32
+	UserID          uuid.UUID
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	Transports      []string
+	Aaguid          []byte
+	Attachment      string
+	SignCount       int64
+	BackupEligible  bool
+	BackupState     bool
+	Name            string
+	LastUsedAt      *time.Time
+	CreatedAt       time.Time
 }
@@ -7,6 +7,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -25,9 +26,77 @@ func (q *Queries) ApiKeyPublicIdTaken(ctx context.Context, publicID string) (boo
 	return column_1, err
 }
 
+const clearLoginFailures = `-- name: ClearLoginFailures :execrows
+DELETE FROM login_failure WHERE kind=$1 AND subject=$2
+`
+
+type ClearLoginFailuresParams struct {
+	Kind    string
+	Subject string
+}
+
+func (q *Queries) ClearLoginFailures(ctx context.Context, arg ClearLoginFailuresParams) (int64, error) {
+	result, err := q.db.Exec(ctx, clearLoginFailures, arg.Kind, arg.Subject)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const confirmTotpSecret = `-- name: ConfirmTotpSecret :exec
+UPDATE totp_secret SET confirmed_at=CURRENT_TIMESTAMP, last_used_step=$2 WHERE user_id=$1
+`
+
+type ConfirmTotpSecretParams struct {
+	UserID       uuid.UUID
+	LastUsedStep int64
+}
+
+func (q *Queries) ConfirmTotpSecret(ctx context.Context, arg ConfirmTotpSecretParams) error {
+	_, err := q.db.Exec(ctx, confirmTotpSecret, arg.UserID, arg.LastUsedStep)
+	return err
+}
+
+const consumeMagicLinkSignup = `-- name: ConsumeMagicLinkSignup :one
+DELETE FROM magic_link_signup
+WHERE token_hash=$1 AND expires_at > CURRENT_TIMESTAMP
+RETURNING email, first_name, last_name
+`
+
+type ConsumeMagicLinkSignupRow struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+func (q *Queries) ConsumeMagicLinkSignup(ctx context.Context, tokenHash []byte) (ConsumeMagicLinkSignupRow, error) {
+	row := q.db.QueryRow(ctx, consumeMagicLinkSignup, tokenHash)
+	var i ConsumeMagicLinkSignupRow
+	err := row.Scan(&i.Email, &i.FirstName, &i.LastName)
+	return i, err
+}
+
+const consumeOneTimeToken = `-- name: ConsumeOneTimeToken :one
+DELETE FROM one_time_token
+WHERE token_hash=$1 AND purpose=$2 AND expires_at > CURRENT_TIMESTAMP
+RETURNING user_id
+`
+
+type ConsumeOneTimeTokenParams struct {
+	TokenHash []byte
+	Purpose   string
+}
+
+func (q *Queries) ConsumeOneTimeToken(ctx context.Context, arg ConsumeOneTimeTokenParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, consumeOneTimeToken, arg.TokenHash, arg.Purpose)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
 const createApiKey = `-- name: CreateApiKey :exec
-INSERT INTO api_key (user_id, public_id, secret_hash, secret_salt)
-VALUES ($1, $2, $3, $4)
+INSERT INTO api_key (user_id, public_id, secret_hash, secret_salt, hash_scheme, name, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 `
 
 type CreateApiKeyParams struct {
@@ -35,6 +104,10 @@ type CreateApiKeyParams struct {
 	PublicID   string
 	SecretHash []byte
 	SecretSalt []byte
+	HashScheme string
+	Name       string
+	Scopes     []string
+	ExpiresAt  *time.Time
 }
 
 func (q *Queries) CreateApiKey(ctx context.Context, arg CreateApiKeyParams) error {
@@ -43,25 +116,181 @@ func (q *Queries) CreateApiKey(ctx context.Context, arg CreateApiKeyParams) erro
 		arg.PublicID,
 		arg.SecretHash,
 		arg.SecretSalt,
+		arg.HashScheme,
+		arg.Name,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createMagicLinkSignup = `-- name: CreateMagicLinkSignup :exec
+INSERT INTO magic_link_signup (email, first_name, last_name, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateMagicLinkSignupParams struct {
+	Email     string
+	FirstName string
+	LastName  string
+	TokenHash []byte
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateMagicLinkSignup(ctx context.Context, arg CreateMagicLinkSignupParams) error {
+	_, err := q.db.Exec(ctx, createMagicLinkSignup,
+		arg.Email,
+		arg.FirstName,
+		arg.LastName,
+		arg.TokenHash,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createMfaChallenge = `-- name: CreateMfaChallenge :exec
+INSERT INTO mfa_challenge (user_id, token_hash, mode, expires_at) VALUES ($1, $2, $3, $4)
+`
+
+type CreateMfaChallengeParams struct {
+	UserID    uuid.UUID
+	TokenHash []byte
+	Mode      string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateMfaChallenge(ctx context.Context, arg CreateMfaChallengeParams) error {
+	_, err := q.db.Exec(ctx, createMfaChallenge,
+		arg.UserID,
+		arg.TokenHash,
+		arg.Mode,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createOneTimeToken = `-- name: CreateOneTimeToken :exec
+INSERT INTO one_time_token (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)
+`
+
+type CreateOneTimeTokenParams struct {
+	UserID    uuid.UUID
+	Purpose   string
+	TokenHash []byte
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateOneTimeToken(ctx context.Context, arg CreateOneTimeTokenParams) error {
+	_, err := q.db.Exec(ctx, createOneTimeToken,
+		arg.UserID,
+		arg.Purpose,
+		arg.TokenHash,
+		arg.ExpiresAt,
 	)
 	return err
 }
 
 const createPasswordAuth = `-- name: CreatePasswordAuth :exec
-INSERT INTO password_auth (user_id, pw_hash, pw_salt) VALUES ($1, $2, $3)
+INSERT INTO password_auth (user_id, pw_hash, pw_normalized) VALUES ($1, $2, $3)
 `
 
 type CreatePasswordAuthParams struct {
-	UserID uuid.UUID
-	PwHash []byte
-	PwSalt []byte
+	UserID       uuid.UUID
+	PwHash       string
+	PwNormalized bool
 }
 
 func (q *Queries) CreatePasswordAuth(ctx context.Context, arg CreatePasswordAuthParams) error {
-	_, err := q.db.Exec(ctx, createPasswordAuth, arg.UserID, arg.PwHash, arg.PwSalt)
+	_, err := q.db.Exec(ctx, createPasswordAuth, arg.UserID, arg.PwHash, arg.PwNormalized)
+	return err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_code (user_id, code_hash, code_salt) VALUES ($1, $2, $3)
+`
+
+type CreateRecoveryCodeParams struct {
+	UserID   uuid.UUID
+	CodeHash []byte
+	CodeSalt []byte
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.Exec(ctx, createRecoveryCode, arg.UserID, arg.CodeHash, arg.CodeSalt)
+	return err
+}
+
+const createRefreshToken = `-- name: CreateRefreshToken :exec
+INSERT INTO refresh_token (user_id, family_id, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateRefreshTokenParams struct {
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash []byte
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error {
+	_, err := q.db.Exec(ctx, createRefreshToken,
+		arg.UserID,
+		arg.FamilyID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createRevokedToken = `-- name: CreateRevokedToken :exec
+INSERT INTO revoked_token (jti, user_id, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (jti) DO NOTHING
+`
+
+type CreateRevokedTokenParams struct {
+	Jti       uuid.UUID
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateRevokedToken(ctx context.Context, arg CreateRevokedTokenParams) error {
+	_, err := q.db.Exec(ctx, createRevokedToken, arg.Jti, arg.UserID, arg.ExpiresAt)
+	return err
+}
+
+const createSigningKey = `-- name: CreateSigningKey :exec
+INSERT INTO signing_key (kid, private_key, activates_at) VALUES ($1, $2, $3)
+`
+
+type CreateSigningKeyParams struct {
+	Kid         string
+	PrivateKey  string
+	ActivatesAt time.Time
+}
+
+func (q *Queries) CreateSigningKey(ctx context.Context, arg CreateSigningKeyParams) error {
+	_, err := q.db.Exec(ctx, createSigningKey, arg.Kid, arg.PrivateKey, arg.ActivatesAt)
 	return err
 }
 
+const createTotpSecret = `-- name: CreateTotpSecret :execrows
+INSERT INTO totp_secret (user_id, secret) VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret, created_at=CURRENT_TIMESTAMP
+WHERE totp_secret.confirmed_at IS NULL
+`
+
+type CreateTotpSecretParams struct {
+	UserID uuid.UUID
+	Secret string
+}
+
+func (q *Queries) CreateTotpSecret(ctx context.Context, arg CreateTotpSecretParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createTotpSecret, arg.UserID, arg.Secret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO user_account (email, first_name, last_name) VALUES ($1, $2, $3) RETURNING id
 `
@@ -79,6 +308,259 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (uuid.UU
 	return id, err
 }
 
+const createUserSession = `-- name: CreateUserSession :one
+INSERT INTO user_session (user_id, ip, user_agent, expires_at) VALUES ($1, $2, $3, $4) RETURNING id
+`
+
+type CreateUserSessionParams struct {
+	UserID    uuid.UUID
+	Ip        string
+	UserAgent string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateUserSession(ctx context.Context, arg CreateUserSessionParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, createUserSession,
+		arg.UserID,
+		arg.Ip,
+		arg.UserAgent,
+		arg.ExpiresAt,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createWebauthnCredential = `-- name: CreateWebauthnCredential :exec
+INSERT INTO webauthn_credential (
+    user_id, credential_id, public_key, attestation_type, transports, aaguid, attachment, sign_count,
+    backup_eligible, backup_state, name
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+`
+
+type CreateWebauthnCredentialParams struct {
+	UserID          uuid.UUID
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	Transports      []string
+	Aaguid          []byte
+	Attachment      string
+	SignCount       int64
+	BackupEligible  bool
+	BackupState     bool
+	Name            string
+}
+
+func (q *Queries) CreateWebauthnCredential(ctx context.Context, arg CreateWebauthnCredentialParams) error {
+	_, err := q.db.Exec(ctx, createWebauthnCredential,
+		arg.UserID,
+		arg.CredentialID,
+		arg.PublicKey,
+		arg.AttestationType,
+		arg.Transports,
+		arg.Aaguid,
+		arg.Attachment,
+		arg.SignCount,
+		arg.BackupEligible,
+		arg.BackupState,
+		arg.Name,
+	)
+	return err
+}
+
+const deleteExpiredMagicLinkSignups = `-- name: DeleteExpiredMagicLinkSignups :exec
+DELETE FROM magic_link_signup WHERE expires_at <= CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredMagicLinkSignups(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredMagicLinkSignups)
+	return err
+}
+
+const deleteExpiredMfaChallenges = `-- name: DeleteExpiredMfaChallenges :exec
+DELETE FROM mfa_challenge WHERE expires_at <= CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredMfaChallenges(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredMfaChallenges)
+	return err
+}
+
+const deleteExpiredOneTimeTokens = `-- name: DeleteExpiredOneTimeTokens :exec
+DELETE FROM one_time_token WHERE expires_at <= CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredOneTimeTokens(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredOneTimeTokens)
+	return err
+}
+
+const deleteExpiredRevokedTokens = `-- name: DeleteExpiredRevokedTokens :execrows
+DELETE FROM revoked_token WHERE expires_at <= CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredRevokedTokens(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredRevokedTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteExpiredTokenCutoffs = `-- name: DeleteExpiredTokenCutoffs :execrows
+DELETE FROM token_cutoff WHERE expires_at <= CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredTokenCutoffs(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredTokenCutoffs)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteExpiredUserSessions = `-- name: DeleteExpiredUserSessions :exec
+DELETE FROM user_session WHERE expires_at <= CURRENT_TIMESTAMP
+`
+
+func (q *Queries) DeleteExpiredUserSessions(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredUserSessions)
+	return err
+}
+
+const deleteIdleRateLimitBuckets = `-- name: DeleteIdleRateLimitBuckets :exec
+DELETE FROM rate_limit_bucket WHERE updated_at < $1
+`
+
+func (q *Queries) DeleteIdleRateLimitBuckets(ctx context.Context, updatedAt time.Time) error {
+	_, err := q.db.Exec(ctx, deleteIdleRateLimitBuckets, updatedAt)
+	return err
+}
+
+const deleteMagicLinkSignups = `-- name: DeleteMagicLinkSignups :exec
+DELETE FROM magic_link_signup WHERE email=$1
+`
+
+func (q *Queries) DeleteMagicLinkSignups(ctx context.Context, email string) error {
+	_, err := q.db.Exec(ctx, deleteMagicLinkSignups, email)
+	return err
+}
+
+const deleteMail = `-- name: DeleteMail :exec
+DELETE FROM mail_outbox WHERE id=$1
+`
+
+func (q *Queries) DeleteMail(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, deleteMail, id)
+	return err
+}
+
+const deleteMfaChallenge = `-- name: DeleteMfaChallenge :exec
+DELETE FROM mfa_challenge WHERE id=$1
+`
+
+func (q *Queries) DeleteMfaChallenge(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, deleteMfaChallenge, id)
+	return err
+}
+
+const deleteMfaChallenges = `-- name: DeleteMfaChallenges :exec
+DELETE FROM mfa_challenge WHERE user_id=$1
+`
+
+func (q *Queries) DeleteMfaChallenges(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteMfaChallenges, userID)
+	return err
+}
+
+const deleteOneTimeTokens = `-- name: DeleteOneTimeTokens :exec
+DELETE FROM one_time_token WHERE user_id=$1 AND purpose=$2
+`
+
+type DeleteOneTimeTokensParams struct {
+	UserID  uuid.UUID
+	Purpose string
+}
+
+func (q *Queries) DeleteOneTimeTokens(ctx context.Context, arg DeleteOneTimeTokensParams) error {
+	_, err := q.db.Exec(ctx, deleteOneTimeTokens, arg.UserID, arg.Purpose)
+	return err
+}
+
+const deleteOtherUserSessions = `-- name: DeleteOtherUserSessions :exec
+DELETE FROM user_session WHERE user_id=$1 AND id <> $2
+`
+
+type DeleteOtherUserSessionsParams struct {
+	UserID uuid.UUID
+	ID     uuid.UUID
+}
+
+func (q *Queries) DeleteOtherUserSessions(ctx context.Context, arg DeleteOtherUserSessionsParams) error {
+	_, err := q.db.Exec(ctx, deleteOtherUserSessions, arg.UserID, arg.ID)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_code WHERE user_id=$1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteRecoveryCodes, userID)
+	return err
+}
+
+const deleteSigningKey = `-- name: DeleteSigningKey :execrows
+DELETE FROM signing_key WHERE kid=$1
+`
+
+func (q *Queries) DeleteSigningKey(ctx context.Context, kid string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSigningKey, kid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteStaleLoginFailures = `-- name: DeleteStaleLoginFailures :exec
+DELETE FROM login_failure
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP)
+`
+
+func (q *Queries) DeleteStaleLoginFailures(ctx context.Context, lastFailureAt time.Time) error {
+	_, err := q.db.Exec(ctx, deleteStaleLoginFailures, lastFailureAt)
+	return err
+}
+
+const deleteUnverifiedPasswordAuth = `-- name: DeleteUnverifiedPasswordAuth :exec
+DELETE FROM password_auth pa USING user_account ua
+WHERE pa.user_id=$1 AND ua.id=pa.user_id AND ua.email_verified_at IS NULL
+`
+
+func (q *Queries) DeleteUnverifiedPasswordAuth(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteUnverifiedPasswordAuth, userID)
+	return err
+}
+
+const deleteUserSession = `-- name: DeleteUserSession :execrows
+DELETE FROM user_session WHERE id=$1 AND user_id=$2
+`
+
+type DeleteUserSessionParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteUserSession(ctx context.Context, arg DeleteUserSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserSession, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const emailTaken = `-- name: EmailTaken :one
 SELECT
     CASE WHEN EXISTS (
@@ -95,63 +577,1078 @@ func (q *Queries) EmailTaken(ctx context.Context, email string) (bool, error) {
 	return column_1, err
 }
 
+const enqueueMail = `-- name: EnqueueMail :exec
+INSERT INTO mail_outbox (recipient, subject, text_body, html_body) VALUES ($1, $2, $3, $4)
+`
+
+type EnqueueMailParams struct {
+	Recipient string
+	Subject   string
+	TextBody  string
+	HtmlBody  string
+}
+
+func (q *Queries) EnqueueMail(ctx context.Context, arg EnqueueMailParams) error {
+	_, err := q.db.Exec(ctx, enqueueMail,
+		arg.Recipient,
+		arg.Subject,
+		arg.TextBody,
+		arg.HtmlBody,
+	)
+	return err
+}
+
 const findApiKey = `-- name: FindApiKey :one
-SELECT user_id, public_id, secret_hash, secret_salt
+SELECT id, user_id, public_id, secret_hash, secret_salt, hash_scheme, revoked_at, scopes, expires_at
 FROM api_key
 WHERE public_id=$1
 `
 
 type FindApiKeyRow struct {
+	ID         int32
 	UserID     uuid.UUID
 	PublicID   string
 	SecretHash []byte
 	SecretSalt []byte
+	HashScheme string
+	RevokedAt  *time.Time
+	Scopes     []string
+	ExpiresAt  *time.Time
 }
 
 func (q *Queries) FindApiKey(ctx context.Context, publicID string) (FindApiKeyRow, error) {
 	row := q.db.QueryRow(ctx, findApiKey, publicID)
 	var i FindApiKeyRow
 	err := row.Scan(
+		&i.ID,
 		&i.UserID,
 		&i.PublicID,
 		&i.SecretHash,
 		&i.SecretSalt,
+		&i.HashScheme,
+		&i.RevokedAt,
+		&i.Scopes,
+		&i.ExpiresAt,
 	)
 	return i, err
 }
 
-const getPasswordAuth = `-- name: GetPasswordAuth :one
-SELECT ua.id, pa.pw_hash, pa.pw_salt
-FROM user_account ua
-JOIN password_auth pa ON pa.user_id = ua.id
-WHERE ua.email=$1
+const findApiKeyForRotation = `-- name: FindApiKeyForRotation :one
+SELECT id, name, scopes, created_at, expires_at, rotated_at
+FROM api_key
+WHERE user_id=$1 AND public_id=$2 AND revoked_at IS NULL
+FOR UPDATE
 `
 
-type GetPasswordAuthRow struct {
-	ID     uuid.UUID
-	PwHash []byte
-	PwSalt []byte
+type FindApiKeyForRotationParams struct {
+	UserID   uuid.UUID
+	PublicID string
 }
 
-func (q *Queries) GetPasswordAuth(ctx context.Context, email string) (GetPasswordAuthRow, error) {
-	row := q.db.QueryRow(ctx, getPasswordAuth, email)
-	var i GetPasswordAuthRow
-	err := row.Scan(&i.ID, &i.PwHash, &i.PwSalt)
+type FindApiKeyForRotationRow struct {
+	ID        int32
+	Name      string
+	Scopes    []string
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	RotatedAt *time.Time
+}
+
+func (q *Queries) FindApiKeyForRotation(ctx context.Context, arg FindApiKeyForRotationParams) (FindApiKeyForRotationRow, error) {
+	row := q.db.QueryRow(ctx, findApiKeyForRotation, arg.UserID, arg.PublicID)
+	var i FindApiKeyForRotationRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.RotatedAt,
+	)
 	return i, err
 }
 
-const getUserInfo = `-- name: GetUserInfo :one
-SELECT first_name, last_name FROM user_account WHERE id=$1
+const findLoginLock = `-- name: FindLoginLock :one
+SELECT locked_until FROM login_failure WHERE kind=$1 AND subject=$2 AND locked_until > CURRENT_TIMESTAMP
 `
 
-type GetUserInfoRow struct {
-	FirstName string
-	LastName  string
+type FindLoginLockParams struct {
+	Kind    string
+	Subject string
 }
 
-func (q *Queries) GetUserInfo(ctx context.Context, id uuid.UUID) (GetUserInfoRow, error) {
-	row := q.db.QueryRow(ctx, getUserInfo, id)
-	var i GetUserInfoRow
-	err := row.Scan(&i.FirstName, &i.LastName)
+func (q *Queries) FindLoginLock(ctx context.Context, arg FindLoginLockParams) (*time.Time, error) {
+	row := q.db.QueryRow(ctx, findLoginLock, arg.Kind, arg.Subject)
+	var locked_until *time.Time
+	err := row.Scan(&locked_until)
+	return locked_until, err
+}
+
+const findMfaChallengeForUpdate = `-- name: FindMfaChallengeForUpdate :one
+SELECT id, user_id, mode, attempts, expires_at
+FROM mfa_challenge
+WHERE token_hash=$1
+FOR UPDATE
+`
+
+type FindMfaChallengeForUpdateRow struct {
+	ID        int32
+	UserID    uuid.UUID
+	Mode      string
+	Attempts  int32
+	ExpiresAt time.Time
+}
+
+func (q *Queries) FindMfaChallengeForUpdate(ctx context.Context, tokenHash []byte) (FindMfaChallengeForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, findMfaChallengeForUpdate, tokenHash)
+	var i FindMfaChallengeForUpdateRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Mode,
+		&i.Attempts,
+		&i.ExpiresAt,
+	)
 	return i, err
 }
+
+const findMfaChallengeUser = `-- name: FindMfaChallengeUser :one
+SELECT user_id FROM mfa_challenge WHERE token_hash=$1 AND expires_at > CURRENT_TIMESTAMP
+`
+
+func (q *Queries) FindMfaChallengeUser(ctx context.Context, tokenHash []byte) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, findMfaChallengeUser, tokenHash)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const findOneTimeToken = `-- name: FindOneTimeToken :one
+SELECT user_id FROM one_time_token WHERE token_hash=$1 AND purpose=$2 AND expires_at > CURRENT_TIMESTAMP
+`
+
+type FindOneTimeTokenParams struct {
+	TokenHash []byte
+	Purpose   string
+}
+
+func (q *Queries) FindOneTimeToken(ctx context.Context, arg FindOneTimeTokenParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, findOneTimeToken, arg.TokenHash, arg.Purpose)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const findRateLimitBucketForUpdate = `-- name: FindRateLimitBucketForUpdate :one
+SELECT tokens, updated_at FROM rate_limit_bucket WHERE key=$1 FOR UPDATE
+`
+
+type FindRateLimitBucketForUpdateRow struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+func (q *Queries) FindRateLimitBucketForUpdate(ctx context.Context, key string) (FindRateLimitBucketForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, findRateLimitBucketForUpdate, key)
+	var i FindRateLimitBucketForUpdateRow
+	err := row.Scan(&i.Tokens, &i.UpdatedAt)
+	return i, err
+}
+
+const findRefreshToken = `-- name: FindRefreshToken :one
+SELECT user_id, family_id FROM refresh_token WHERE token_hash=$1
+`
+
+type FindRefreshTokenRow struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) FindRefreshToken(ctx context.Context, tokenHash []byte) (FindRefreshTokenRow, error) {
+	row := q.db.QueryRow(ctx, findRefreshToken, tokenHash)
+	var i FindRefreshTokenRow
+	err := row.Scan(&i.UserID, &i.FamilyID)
+	return i, err
+}
+
+const findRefreshTokenForUpdate = `-- name: FindRefreshTokenForUpdate :one
+SELECT id, user_id, family_id, used_at, revoked_at, expires_at
+FROM refresh_token
+WHERE token_hash=$1
+FOR UPDATE
+`
+
+type FindRefreshTokenForUpdateRow struct {
+	ID        int32
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	ExpiresAt time.Time
+}
+
+func (q *Queries) FindRefreshTokenForUpdate(ctx context.Context, tokenHash []byte) (FindRefreshTokenForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, findRefreshTokenForUpdate, tokenHash)
+	var i FindRefreshTokenForUpdateRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FamilyID,
+		&i.UsedAt,
+		&i.RevokedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const findTotpSecret = `-- name: FindTotpSecret :one
+SELECT secret, last_used_step, confirmed_at FROM totp_secret WHERE user_id=$1
+`
+
+type FindTotpSecretRow struct {
+	Secret       string
+	LastUsedStep int64
+	ConfirmedAt  *time.Time
+}
+
+func (q *Queries) FindTotpSecret(ctx context.Context, userID uuid.UUID) (FindTotpSecretRow, error) {
+	row := q.db.QueryRow(ctx, findTotpSecret, userID)
+	var i FindTotpSecretRow
+	err := row.Scan(&i.Secret, &i.LastUsedStep, &i.ConfirmedAt)
+	return i, err
+}
+
+const findTotpSecretForUpdate = `-- name: FindTotpSecretForUpdate :one
+SELECT secret, last_used_step, confirmed_at FROM totp_secret WHERE user_id=$1 FOR UPDATE
+`
+
+type FindTotpSecretForUpdateRow struct {
+	Secret       string
+	LastUsedStep int64
+	ConfirmedAt  *time.Time
+}
+
+func (q *Queries) FindTotpSecretForUpdate(ctx context.Context, userID uuid.UUID) (FindTotpSecretForUpdateRow, error) {
+	row := q.db.QueryRow(ctx, findTotpSecretForUpdate, userID)
+	var i FindTotpSecretForUpdateRow
+	err := row.Scan(&i.Secret, &i.LastUsedStep, &i.ConfirmedAt)
+	return i, err
+}
+
+const findUserEmailVerification = `-- name: FindUserEmailVerification :one
+SELECT id, email_verified_at FROM user_account WHERE email=$1
+`
+
+type FindUserEmailVerificationRow struct {
+	ID              uuid.UUID
+	EmailVerifiedAt *time.Time
+}
+
+func (q *Queries) FindUserEmailVerification(ctx context.Context, email string) (FindUserEmailVerificationRow, error) {
+	row := q.db.QueryRow(ctx, findUserEmailVerification, email)
+	var i FindUserEmailVerificationRow
+	err := row.Scan(&i.ID, &i.EmailVerifiedAt)
+	return i, err
+}
+
+const findUserIdByEmail = `-- name: FindUserIdByEmail :one
+SELECT id FROM user_account WHERE email=$1
+`
+
+func (q *Queries) FindUserIdByEmail(ctx context.Context, email string) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, findUserIdByEmail, email)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getPasswordAuth = `-- name: GetPasswordAuth :one
+SELECT ua.id, ua.email_verified_at, pa.pw_hash, pa.pw_normalized
+FROM user_account ua
+JOIN password_auth pa ON pa.user_id = ua.id
+WHERE ua.email=$1
+`
+
+type GetPasswordAuthRow struct {
+	ID              uuid.UUID
+	EmailVerifiedAt *time.Time
+	PwHash          string
+	PwNormalized    bool
+}
+
+func (q *Queries) GetPasswordAuth(ctx context.Context, email string) (GetPasswordAuthRow, error) {
+	row := q.db.QueryRow(ctx, getPasswordAuth, email)
+	var i GetPasswordAuthRow
+	err := row.Scan(
+		&i.ID,
+		&i.EmailVerifiedAt,
+		&i.PwHash,
+		&i.PwNormalized,
+	)
+	return i, err
+}
+
+const getPasswordHash = `-- name: GetPasswordHash :one
+SELECT pw_hash, pw_normalized FROM password_auth WHERE user_id=$1
+`
+
+type GetPasswordHashRow struct {
+	PwHash       string
+	PwNormalized bool
+}
+
+func (q *Queries) GetPasswordHash(ctx context.Context, userID uuid.UUID) (GetPasswordHashRow, error) {
+	row := q.db.QueryRow(ctx, getPasswordHash, userID)
+	var i GetPasswordHashRow
+	err := row.Scan(&i.PwHash, &i.PwNormalized)
+	return i, err
+}
+
+const getUserAccount = `-- name: GetUserAccount :one
+SELECT email, first_name, last_name FROM user_account WHERE id=$1
+`
+
+type GetUserAccountRow struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+func (q *Queries) GetUserAccount(ctx context.Context, id uuid.UUID) (GetUserAccountRow, error) {
+	row := q.db.QueryRow(ctx, getUserAccount, id)
+	var i GetUserAccountRow
+	err := row.Scan(&i.Email, &i.FirstName, &i.LastName)
+	return i, err
+}
+
+const getUserEmail = `-- name: GetUserEmail :one
+SELECT email FROM user_account WHERE id=$1
+`
+
+func (q *Queries) GetUserEmail(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRow(ctx, getUserEmail, id)
+	var email string
+	err := row.Scan(&email)
+	return email, err
+}
+
+const getUserInfo = `-- name: GetUserInfo :one
+SELECT
+    first_name,
+    last_name,
+    (SELECT COUNT(*) FROM recovery_code WHERE user_id=$1 AND used_at IS NULL) AS recovery_codes_remaining
+FROM user_account
+WHERE id=$1
+`
+
+type GetUserInfoRow struct {
+	FirstName              string
+	LastName               string
+	RecoveryCodesRemaining int64
+}
+
+func (q *Queries) GetUserInfo(ctx context.Context, userID uuid.UUID) (GetUserInfoRow, error) {
+	row := q.db.QueryRow(ctx, getUserInfo, userID)
+	var i GetUserInfoRow
+	err := row.Scan(&i.FirstName, &i.LastName, &i.RecoveryCodesRemaining)
+	return i, err
+}
+
+const incrementMfaChallengeAttempts = `-- name: IncrementMfaChallengeAttempts :exec
+UPDATE mfa_challenge SET attempts=attempts+1 WHERE id=$1
+`
+
+func (q *Queries) IncrementMfaChallengeAttempts(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, incrementMfaChallengeAttempts, id)
+	return err
+}
+
+const lastOneTimeTokenCreatedAt = `-- name: LastOneTimeTokenCreatedAt :one
+SELECT created_at FROM one_time_token WHERE user_id=$1 AND purpose=$2 ORDER BY created_at DESC LIMIT 1
+`
+
+type LastOneTimeTokenCreatedAtParams struct {
+	UserID  uuid.UUID
+	Purpose string
+}
+
+func (q *Queries) LastOneTimeTokenCreatedAt(ctx context.Context, arg LastOneTimeTokenCreatedAtParams) (time.Time, error) {
+	row := q.db.QueryRow(ctx, lastOneTimeTokenCreatedAt, arg.UserID, arg.Purpose)
+	var created_at time.Time
+	err := row.Scan(&created_at)
+	return created_at, err
+}
+
+const listApiKeys = `-- name: ListApiKeys :many
+SELECT public_id, name, scopes, created_at, last_used_at, expires_at, rotated_at
+FROM api_key
+WHERE user_id=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+ORDER BY created_at
+`
+
+type ListApiKeysRow struct {
+	PublicID   string
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RotatedAt  *time.Time
+}
+
+func (q *Queries) ListApiKeys(ctx context.Context, userID uuid.UUID) ([]ListApiKeysRow, error) {
+	rows, err := q.db.Query(ctx, listApiKeys, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListApiKeysRow
+	for rows.Next() {
+		var i ListApiKeysRow
+		if err := rows.Scan(
+			&i.PublicID,
+			&i.Name,
+			&i.Scopes,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.RotatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDueMailForUpdate = `-- name: ListDueMailForUpdate :many
+SELECT id, recipient, subject, text_body, html_body, attempts
+FROM mail_outbox
+WHERE next_attempt_at <= CURRENT_TIMESTAMP
+ORDER BY next_attempt_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED
+`
+
+type ListDueMailForUpdateRow struct {
+	ID        int32
+	Recipient string
+	Subject   string
+	TextBody  string
+	HtmlBody  string
+	Attempts  int32
+}
+
+func (q *Queries) ListDueMailForUpdate(ctx context.Context, limit int32) ([]ListDueMailForUpdateRow, error) {
+	rows, err := q.db.Query(ctx, listDueMailForUpdate, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDueMailForUpdateRow
+	for rows.Next() {
+		var i ListDueMailForUpdateRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Recipient,
+			&i.Subject,
+			&i.TextBody,
+			&i.HtmlBody,
+			&i.Attempts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLoginLocks = `-- name: ListLoginLocks :many
+SELECT locked_until
+FROM login_failure
+WHERE ((kind='account' AND subject=$1) OR (kind='ip' AND subject=$2))
+    AND locked_until > CURRENT_TIMESTAMP
+`
+
+type ListLoginLocksParams struct {
+	Email string
+	Ip    string
+}
+
+func (q *Queries) ListLoginLocks(ctx context.Context, arg ListLoginLocksParams) ([]*time.Time, error) {
+	rows, err := q.db.Query(ctx, listLoginLocks, arg.Email, arg.Ip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*time.Time
+	for rows.Next() {
+		var locked_until *time.Time
+		if err := rows.Scan(&locked_until); err != nil {
+			return nil, err
+		}
+		items = append(items, locked_until)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRevokedTokens = `-- name: ListRevokedTokens :many
+SELECT jti, expires_at FROM revoked_token WHERE expires_at > CURRENT_TIMESTAMP
+`
+
+type ListRevokedTokensRow struct {
+	Jti       uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) ListRevokedTokens(ctx context.Context) ([]ListRevokedTokensRow, error) {
+	rows, err := q.db.Query(ctx, listRevokedTokens)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRevokedTokensRow
+	for rows.Next() {
+		var i ListRevokedTokensRow
+		if err := rows.Scan(&i.Jti, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSigningKeys = `-- name: ListSigningKeys :many
+SELECT kid, private_key, activates_at, retires_at
+FROM signing_key
+ORDER BY activates_at, id
+`
+
+type ListSigningKeysRow struct {
+	Kid         string
+	PrivateKey  string
+	ActivatesAt time.Time
+	RetiresAt   *time.Time
+}
+
+func (q *Queries) ListSigningKeys(ctx context.Context) ([]ListSigningKeysRow, error) {
+	rows, err := q.db.Query(ctx, listSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSigningKeysRow
+	for rows.Next() {
+		var i ListSigningKeysRow
+		if err := rows.Scan(
+			&i.Kid,
+			&i.PrivateKey,
+			&i.ActivatesAt,
+			&i.RetiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTokenCutoffs = `-- name: ListTokenCutoffs :many
+SELECT user_id, revoked_before, expires_at FROM token_cutoff WHERE expires_at > CURRENT_TIMESTAMP
+`
+
+func (q *Queries) ListTokenCutoffs(ctx context.Context) ([]TokenCutoff, error) {
+	rows, err := q.db.Query(ctx, listTokenCutoffs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TokenCutoff
+	for rows.Next() {
+		var i TokenCutoff
+		if err := rows.Scan(&i.UserID, &i.RevokedBefore, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnusedRecoveryCodeSalts = `-- name: ListUnusedRecoveryCodeSalts :many
+SELECT DISTINCT code_salt FROM recovery_code WHERE user_id=$1 AND used_at IS NULL
+`
+
+func (q *Queries) ListUnusedRecoveryCodeSalts(ctx context.Context, userID uuid.UUID) ([][]byte, error) {
+	rows, err := q.db.Query(ctx, listUnusedRecoveryCodeSalts, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items [][]byte
+	for rows.Next() {
+		var code_salt []byte
+		if err := rows.Scan(&code_salt); err != nil {
+			return nil, err
+		}
+		items = append(items, code_salt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnusedRecoveryCodesForUpdate = `-- name: ListUnusedRecoveryCodesForUpdate :many
+SELECT id, code_hash, code_salt
+FROM recovery_code
+WHERE user_id=$1 AND used_at IS NULL
+FOR UPDATE
+`
+
+type ListUnusedRecoveryCodesForUpdateRow struct {
+	ID       int32
+	CodeHash []byte
+	CodeSalt []byte
+}
+
+func (q *Queries) ListUnusedRecoveryCodesForUpdate(ctx context.Context, userID uuid.UUID) ([]ListUnusedRecoveryCodesForUpdateRow, error) {
+	rows, err := q.db.Query(ctx, listUnusedRecoveryCodesForUpdate, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUnusedRecoveryCodesForUpdateRow
+	for rows.Next() {
+		var i ListUnusedRecoveryCodesForUpdateRow
+		if err := rows.Scan(&i.ID, &i.CodeHash, &i.CodeSalt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserSessions = `-- name: ListUserSessions :many
+SELECT id, ip, user_agent, created_at, last_seen_at FROM user_session
+WHERE user_id=$1 AND expires_at > CURRENT_TIMESTAMP
+ORDER BY last_seen_at DESC
+`
+
+type ListUserSessionsRow struct {
+	ID         uuid.UUID
+	Ip         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+func (q *Queries) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]ListUserSessionsRow, error) {
+	rows, err := q.db.Query(ctx, listUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserSessionsRow
+	for rows.Next() {
+		var i ListUserSessionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Ip,
+			&i.UserAgent,
+			&i.CreatedAt,
+			&i.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebauthnCredentials = `-- name: ListWebauthnCredentials :many
+SELECT id, user_id, credential_id, public_key, attestation_type, transports, aaguid, attachment, sign_count, backup_eligible, backup_state, name, last_used_at, created_at FROM webauthn_credential WHERE user_id=$1 ORDER BY created_at
+`
+
+func (q *Queries) ListWebauthnCredentials(ctx context.Context, userID uuid.UUID) ([]WebauthnCredential, error) {
+	rows, err := q.db.Query(ctx, listWebauthnCredentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.CredentialID,
+			&i.PublicKey,
+			&i.AttestationType,
+			&i.Transports,
+			&i.Aaguid,
+			&i.Attachment,
+			&i.SignCount,
+			&i.BackupEligible,
+			&i.BackupState,
+			&i.Name,
+			&i.LastUsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockLogin = `-- name: LockLogin :exec
+UPDATE login_failure SET locked_until=$3 WHERE kind=$1 AND subject=$2
+`
+
+type LockLoginParams struct {
+	Kind        string
+	Subject     string
+	LockedUntil *time.Time
+}
+
+func (q *Queries) LockLogin(ctx context.Context, arg LockLoginParams) error {
+	_, err := q.db.Exec(ctx, lockLogin, arg.Kind, arg.Subject, arg.LockedUntil)
+	return err
+}
+
+const markApiKeyRotated = `-- name: MarkApiKeyRotated :exec
+UPDATE api_key SET rotated_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP, expires_at=$2
+WHERE id=$1
+`
+
+type MarkApiKeyRotatedParams struct {
+	ID        int32
+	ExpiresAt *time.Time
+}
+
+func (q *Queries) MarkApiKeyRotated(ctx context.Context, arg MarkApiKeyRotatedParams) error {
+	_, err := q.db.Exec(ctx, markApiKeyRotated, arg.ID, arg.ExpiresAt)
+	return err
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :exec
+UPDATE user_account SET email_verified_at=CURRENT_TIMESTAMP WHERE id=$1 AND email_verified_at IS NULL
+`
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, markEmailVerified, id)
+	return err
+}
+
+const markRecoveryCodeUsed = `-- name: MarkRecoveryCodeUsed :exec
+UPDATE recovery_code SET used_at=CURRENT_TIMESTAMP WHERE id=$1
+`
+
+func (q *Queries) MarkRecoveryCodeUsed(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, markRecoveryCodeUsed, id)
+	return err
+}
+
+const markRefreshTokenUsed = `-- name: MarkRefreshTokenUsed :exec
+UPDATE refresh_token SET used_at=CURRENT_TIMESTAMP WHERE id=$1
+`
+
+func (q *Queries) MarkRefreshTokenUsed(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, markRefreshTokenUsed, id)
+	return err
+}
+
+const markTotpStepUsed = `-- name: MarkTotpStepUsed :exec
+UPDATE totp_secret SET last_used_step=$2 WHERE user_id=$1
+`
+
+type MarkTotpStepUsedParams struct {
+	UserID       uuid.UUID
+	LastUsedStep int64
+}
+
+func (q *Queries) MarkTotpStepUsed(ctx context.Context, arg MarkTotpStepUsedParams) error {
+	_, err := q.db.Exec(ctx, markTotpStepUsed, arg.UserID, arg.LastUsedStep)
+	return err
+}
+
+const mfaEnabled = `-- name: MfaEnabled :one
+SELECT
+    CASE WHEN EXISTS (
+        SELECT 1 FROM totp_secret WHERE user_id=$1 AND confirmed_at IS NOT NULL
+    ) THEN true ELSE false END
+`
+
+func (q *Queries) MfaEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, mfaEnabled, userID)
+	var column_1 bool
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_failure (kind, subject, failures) VALUES ($1, $2, 1)
+ON CONFLICT (kind, subject) DO UPDATE SET
+    failures=CASE WHEN login_failure.last_failure_at < $3 THEN 1 ELSE login_failure.failures + 1 END,
+    last_failure_at=CURRENT_TIMESTAMP
+RETURNING failures
+`
+
+type RecordLoginFailureParams struct {
+	Kind        string
+	Subject     string
+	WindowStart time.Time
+}
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (int32, error) {
+	row := q.db.QueryRow(ctx, recordLoginFailure, arg.Kind, arg.Subject, arg.WindowStart)
+	var failures int32
+	err := row.Scan(&failures)
+	return failures, err
+}
+
+const recordMailFailure = `-- name: RecordMailFailure :exec
+UPDATE mail_outbox SET attempts=attempts+1, last_error=$2, next_attempt_at=$3 WHERE id=$1
+`
+
+type RecordMailFailureParams struct {
+	ID            int32
+	LastError     string
+	NextAttemptAt *time.Time
+}
+
+func (q *Queries) RecordMailFailure(ctx context.Context, arg RecordMailFailureParams) error {
+	_, err := q.db.Exec(ctx, recordMailFailure, arg.ID, arg.LastError, arg.NextAttemptAt)
+	return err
+}
+
+const replacePasswordHash = `-- name: ReplacePasswordHash :execrows
+UPDATE password_auth SET pw_hash=$1, pw_normalized=$2
+WHERE user_id=$3 AND pw_hash=$4
+`
+
+type ReplacePasswordHashParams struct {
+	NewHash      string
+	PwNormalized bool
+	UserID       uuid.UUID
+	OldHash      string
+}
+
+func (q *Queries) ReplacePasswordHash(ctx context.Context, arg ReplacePasswordHashParams) (int64, error) {
+	result, err := q.db.Exec(ctx, replacePasswordHash,
+		arg.NewHash,
+		arg.PwNormalized,
+		arg.UserID,
+		arg.OldHash,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const retireSigningKey = `-- name: RetireSigningKey :execrows
+UPDATE signing_key SET retires_at=CURRENT_TIMESTAMP
+WHERE kid=$1 AND (retires_at IS NULL OR retires_at > CURRENT_TIMESTAMP)
+`
+
+func (q *Queries) RetireSigningKey(ctx context.Context, kid string) (int64, error) {
+	result, err := q.db.Exec(ctx, retireSigningKey, kid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeAllApiKeys = `-- name: RevokeAllApiKeys :exec
+UPDATE api_key SET revoked_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+WHERE user_id=$1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllApiKeys(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, revokeAllApiKeys, userID)
+	return err
+}
+
+const revokeAllRefreshTokens = `-- name: RevokeAllRefreshTokens :exec
+UPDATE refresh_token SET revoked_at=CURRENT_TIMESTAMP
+WHERE user_id=$1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, revokeAllRefreshTokens, userID)
+	return err
+}
+
+const revokeApiKey = `-- name: RevokeApiKey :execrows
+UPDATE api_key SET revoked_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+WHERE user_id=$1 AND public_id=$2 AND revoked_at IS NULL
+`
+
+type RevokeApiKeyParams struct {
+	UserID   uuid.UUID
+	PublicID string
+}
+
+func (q *Queries) RevokeApiKey(ctx context.Context, arg RevokeApiKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeApiKey, arg.UserID, arg.PublicID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_token SET revoked_at=CURRENT_TIMESTAMP
+WHERE family_id=$1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const setPasswordAuth = `-- name: SetPasswordAuth :exec
+INSERT INTO password_auth (user_id, pw_hash, pw_normalized) VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE SET pw_hash=EXCLUDED.pw_hash, pw_normalized=EXCLUDED.pw_normalized
+`
+
+type SetPasswordAuthParams struct {
+	UserID       uuid.UUID
+	PwHash       string
+	PwNormalized bool
+}
+
+func (q *Queries) SetPasswordAuth(ctx context.Context, arg SetPasswordAuthParams) error {
+	_, err := q.db.Exec(ctx, setPasswordAuth, arg.UserID, arg.PwHash, arg.PwNormalized)
+	return err
+}
+
+const setRateLimitBucket = `-- name: SetRateLimitBucket :exec
+INSERT INTO rate_limit_bucket (key, tokens, updated_at) VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE SET tokens=EXCLUDED.tokens, updated_at=EXCLUDED.updated_at
+`
+
+type SetRateLimitBucketParams struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+func (q *Queries) SetRateLimitBucket(ctx context.Context, arg SetRateLimitBucketParams) error {
+	_, err := q.db.Exec(ctx, setRateLimitBucket, arg.Key, arg.Tokens, arg.UpdatedAt)
+	return err
+}
+
+const setTokenCutoff = `-- name: SetTokenCutoff :exec
+INSERT INTO token_cutoff (user_id, revoked_before, expires_at) VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE SET revoked_before=EXCLUDED.revoked_before, expires_at=EXCLUDED.expires_at
+`
+
+type SetTokenCutoffParams struct {
+	UserID        uuid.UUID
+	RevokedBefore time.Time
+	ExpiresAt     time.Time
+}
+
+func (q *Queries) SetTokenCutoff(ctx context.Context, arg SetTokenCutoffParams) error {
+	_, err := q.db.Exec(ctx, setTokenCutoff, arg.UserID, arg.RevokedBefore, arg.ExpiresAt)
+	return err
+}
+
+const touchApiKey = `-- name: TouchApiKey :exec
+UPDATE api_key SET last_used_at=CURRENT_TIMESTAMP
+WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+`
+
+func (q *Queries) TouchApiKey(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, touchApiKey, id)
+	return err
+}
+
+const touchUserSession = `-- name: TouchUserSession :one
+WITH active AS (
+    SELECT id FROM user_session WHERE id=$1 AND user_id=$2 AND expires_at > CURRENT_TIMESTAMP
+), touched AS (
+    UPDATE user_session SET last_seen_at = CURRENT_TIMESTAMP
+    WHERE id IN (SELECT id FROM active) AND last_seen_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'
+)
+SELECT EXISTS (SELECT 1 FROM active) AS active
+`
+
+type TouchUserSessionParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) TouchUserSession(ctx context.Context, arg TouchUserSessionParams) (bool, error) {
+	row := q.db.QueryRow(ctx, touchUserSession, arg.ID, arg.UserID)
+	var active bool
+	err := row.Scan(&active)
+	return active, err
+}
+
+const updateWebauthnCredentialUse = `-- name: UpdateWebauthnCredentialUse :exec
+UPDATE webauthn_credential SET sign_count=$2, backup_state=$3, last_used_at=CURRENT_TIMESTAMP
+WHERE credential_id=$1
+`
+
+type UpdateWebauthnCredentialUseParams struct {
+	CredentialID []byte
+	SignCount    int64
+	BackupState  bool
+}
+
+func (q *Queries) UpdateWebauthnCredentialUse(ctx context.Context, arg UpdateWebauthnCredentialUseParams) error {
+	_, err := q.db.Exec(ctx, updateWebauthnCredentialUse, arg.CredentialID, arg.SignCount, arg.BackupState)
+	return err
+}
+
+const upgradeApiKeyHash = `-- name: UpgradeApiKeyHash :exec
+UPDATE api_key SET secret_hash=$2, secret_salt=$3, hash_scheme=$4, updated_at=CURRENT_TIMESTAMP
+WHERE id=$1
+`
+
+type UpgradeApiKeyHashParams struct {
+	ID         int32
+	SecretHash []byte
+	SecretSalt []byte
+	HashScheme string
+}
+
+func (q *Queries) UpgradeApiKeyHash(ctx context.Context, arg UpgradeApiKeyHashParams) error {
+	_, err := q.db.Exec(ctx, upgradeApiKeyHash,
+		arg.ID,
+		arg.SecretHash,
+		arg.SecretSalt,
+		arg.HashScheme,
+	)
+	return err
+}
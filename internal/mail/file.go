@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileSender drop every message into dir as an .eml file, which mail clients can open. Meant for development and
+// tests, where nothing should leave the machine.
+type fileSender struct {
+	dir  string
+	from *netmail.Address
+}
+
+func newFileSender(dir string, from *netmail.Address) (*fileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &fileSender{dir, from}, nil
+}
+
+func (s *fileSender) Send(_ context.Context, msg *Message) error {
+	body, err := msg.format(s.from)
+	if err != nil {
+		return fmt.Errorf("failed to format message: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(s.dir, name), body, 0o644)
+}
+
+// writerSender write every message to w, e.g. stdout
+type writerSender struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from *netmail.Address
+}
+
+func (s *writerSender) Send(_ context.Context, msg *Message) error {
+	body, err := msg.format(s.from)
+	if err != nil {
+		return fmt.Errorf("failed to format message: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintf(s.w, "%s\r\n\r\n", body)
+	return err
+}
@@ -0,0 +1,131 @@
+package mail
+
+import (
+	"auth-strategies/internal/db/repository"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+const (
+	outboxBatchSize = 10
+	sendTimeout     = 30 * time.Second
+	// maxSendAttempts is how many times a message is tried before it is given up on. Such messages stay in the outbox
+	// along with their last error, for inspection.
+	maxSendAttempts = 8
+	// retryBaseDelay is the delay before the first retry, doubled for every further one
+	retryBaseDelay = 30 * time.Second
+)
+
+// Enqueue add a message to the outbox, to be sent by Outbox.Run. Pass the repository of the transaction the message
+// belongs to, so that it is only sent if the transaction commits, and a failing send can't fail the transaction.
+func Enqueue(ctx context.Context, repo *repository.Queries, msg *Message) error {
+	params := repository.EnqueueMailParams{
+		Recipient: msg.To,
+		Subject:   msg.Subject,
+		TextBody:  msg.Text,
+		HtmlBody:  msg.Html,
+	}
+	return repo.EnqueueMail(ctx, params)
+}
+
+// Outbox deliver the messages of the mail_outbox table, retrying failed ones with an exponential backoff. Sent
+// messages are deleted, as they usually contain tokens. A message is sent at least once: it may be sent again if
+// the server stops right after sending it.
+type Outbox struct {
+	pool         *pgxpool.Pool
+	sender       Sender
+	pollInterval time.Duration
+}
+
+func NewOutbox(pool *pgxpool.Pool, sender Sender, pollInterval time.Duration) *Outbox {
+	return &Outbox{pool, sender, pollInterval}
+}
+
+// Run periodically send the messages that are due, until ctx is cancelled. Multiple server instances may run it at
+// the same time, each message is picked up by one of them.
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.flush(ctx); err != nil {
+				log.Error().Err(err).Msg("failed to flush mail outbox")
+			}
+		}
+	}
+}
+
+// flush send batches of due messages until none are left
+func (o *Outbox) flush(ctx context.Context) error {
+	for {
+		n, err := o.sendBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if n < outboxBatchSize {
+			return nil
+		}
+	}
+}
+
+func (o *Outbox) sendBatch(ctx context.Context) (int, error) {
+	tx, err := o.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	rows, err := repo.ListDueMailForUpdate(ctx, outboxBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list due mail: %w", err)
+	}
+
+	for _, row := range rows {
+		msg := &Message{
+			To:      row.Recipient,
+			Subject: row.Subject,
+			Text:    row.TextBody,
+			Html:    row.HtmlBody,
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		sendErr := o.sender.Send(sendCtx, msg)
+		cancel()
+
+		if sendErr == nil {
+			if err := repo.DeleteMail(ctx, row.ID); err != nil {
+				return 0, fmt.Errorf("failed to delete sent mail: %w", err)
+			}
+			continue
+		}
+
+		var nextAttemptAt *time.Time
+		if row.Attempts+1 < maxSendAttempts {
+			next := time.Now().Add(retryBaseDelay << row.Attempts)
+			nextAttemptAt = &next
+		}
+		log.Warn().Err(sendErr).Int32("id", row.ID).Bool("retry", nextAttemptAt != nil).Msg("failed to send mail")
+
+		params := repository.RecordMailFailureParams{
+			ID:            row.ID,
+			LastError:     sendErr.Error(),
+			NextAttemptAt: nextAttemptAt,
+		}
+		if err := repo.RecordMailFailure(ctx, params); err != nil {
+			return 0, fmt.Errorf("failed to record mail failure: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,90 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+)
+
+// Templates available to Render, each consisting of a .txt and an .html file in the templates directory. The text
+// template also defines the subject.
+const (
+	TemplateEmailVerification = "email_verification"
+	TemplatePasswordReset     = "password_reset"
+	TemplateMagicLink         = "magic_link"
+)
+
+// TokenData data of the templates delivering a one-time token
+type TokenData struct {
+	Token    string
+	ValidFor time.Duration
+}
+
+// LinkData data of the templates delivering a single-use link
+type LinkData struct {
+	Link     string
+	ValidFor time.Duration
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+type mailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var templates = mustParseTemplates(TemplateEmailVerification, TemplatePasswordReset, TemplateMagicLink)
+
+func mustParseTemplates(names ...string) map[string]mailTemplate {
+	funcs := map[string]any{"duration": formatDuration}
+	parsed := make(map[string]mailTemplate, len(names))
+	for _, name := range names {
+		parsed[name] = mailTemplate{
+			text: texttemplate.Must(texttemplate.New(name+".txt").Funcs(funcs).ParseFS(templateFS, "templates/"+name+".txt")),
+			html: htmltemplate.Must(htmltemplate.New(name+".html").Funcs(funcs).ParseFS(templateFS, "templates/"+name+".html")),
+		}
+	}
+	return parsed
+}
+
+// Render fill in the template called name for the recipient to
+func Render(name string, to string, data any) (*Message, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mail template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.html.Execute(&html, data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      to,
+		Subject: subject.String(),
+		Text:    text.String(),
+		Html:    html.String(),
+	}, nil
+}
+
+// formatDuration spell out a duration for humans, e.g. "30 minutes" or "24 hours"
+func formatDuration(d time.Duration) string {
+	unit, n := "minute", int(d/time.Minute)
+	if d >= time.Hour && d%time.Hour == 0 {
+		unit, n = "hour", int(d/time.Hour)
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
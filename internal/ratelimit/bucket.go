@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"auth-strategies/internal/config"
+	"time"
+)
+
+// bucket a token bucket: it holds up to Burst tokens and refills at Burst per Period, every request takes a token
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// result the outcome of taking a token
+type result struct {
+	allowed   bool
+	remaining int
+	// reset is how long until the bucket is full again
+	reset time.Duration
+	// retryAfter is how long until the next token, if the request was not allowed
+	retryAfter time.Duration
+}
+
+func newBucket(limit config.RateLimit, now time.Time) *bucket {
+	return &bucket{tokens: float64(limit.Burst), updatedAt: now}
+}
+
+// take refill the bucket for the time passed since it was last updated, and take a token if there is one
+func (b *bucket) take(limit config.RateLimit, now time.Time) result {
+	rate := float64(limit.Burst) / limit.Period.Seconds()
+	elapsed := max(now.Sub(b.updatedAt).Seconds(), 0)
+	b.tokens = min(float64(limit.Burst), b.tokens+elapsed*rate)
+	b.updatedAt = now
+
+	var res result
+	if b.tokens >= 1 {
+		b.tokens--
+		res.allowed = true
+	} else {
+		res.retryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.remaining = int(b.tokens)
+	res.reset = seconds((float64(limit.Burst) - b.tokens) / rate)
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"auth-strategies/internal/config"
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryStore keep the buckets in memory, every server instance limits on its own
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *memoryStore) take(_ context.Context, key string, limit config.RateLimit, now time.Time) (result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = newBucket(limit, now)
+		s.buckets[key] = b
+	}
+	return b.take(limit, now), nil
+}
+
+func (s *memoryStore) deleteIdle(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if b.updatedAt.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
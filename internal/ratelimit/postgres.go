@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"auth-strategies/internal/config"
+	"auth-strategies/internal/db/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// postgresStore keep the buckets in the database, so that they are shared between server instances. The row of a
+// bucket is locked while a token is taken from it. Two requests creating the same bucket at once may both take a token
+// from a full bucket, which is not worth an extra round trip to prevent.
+type postgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func (s *postgresStore) take(ctx context.Context, key string, limit config.RateLimit, now time.Time) (result, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return result{}, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	repo := repository.New(tx)
+
+	b := newBucket(limit, now)
+	row, err := repo.FindRateLimitBucketForUpdate(ctx, key)
+	if err == nil {
+		b = &bucket{tokens: row.Tokens, updatedAt: row.UpdatedAt}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return result{}, fmt.Errorf("failed to find rate limit bucket: %w", err)
+	}
+
+	res := b.take(limit, now)
+
+	params := repository.SetRateLimitBucketParams{
+		Key:       key,
+		Tokens:    b.tokens,
+		UpdatedAt: b.updatedAt,
+	}
+	if err := repo.SetRateLimitBucket(ctx, params); err != nil {
+		return result{}, fmt.Errorf("failed to set rate limit bucket: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result{}, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return res, nil
+}
+
+func (s *postgresStore) deleteIdle(ctx context.Context, before time.Time) error {
+	return repository.New(s.pool).DeleteIdleRateLimitBuckets(ctx, before)
+}
@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"auth-strategies/internal/common"
+	"auth-strategies/internal/config"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	tooManyRequests = "Too many requests"
+	// sweepInterval is how often buckets that have been full for a while are deleted
+	sweepInterval = time.Minute
+)
+
+type store interface {
+	take(ctx context.Context, key string, limit config.RateLimit, now time.Time) (result, error)
+	// deleteIdle delete the buckets not used since before
+	deleteIdle(ctx context.Context, before time.Time) error
+}
+
+// Limiter limit request rates with token buckets, each middleware created by Limit keeping a bucket per key
+type Limiter struct {
+	store store
+
+	mu sync.Mutex
+	// maxPeriod is the longest period of the limits in use, buckets idle for longer are full and can be deleted
+	maxPeriod time.Duration
+}
+
+// New create a limiter keeping its buckets in the backend selected in cfg
+func New(cfg *config.RateLimitConfig, pool *pgxpool.Pool) (*Limiter, error) {
+	switch cfg.Backend {
+	case "memory":
+		return &Limiter{store: newMemoryStore()}, nil
+	case "postgres":
+		return &Limiter{store: &postgresStore{pool}}, nil
+	}
+	return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+}
+
+// Run periodically delete idle buckets, until ctx is cancelled
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			maxPeriod := l.maxPeriod
+			l.mu.Unlock()
+			if err := l.store.deleteIdle(ctx, time.Now().Add(-maxPeriod)); err != nil {
+				log.Error().Err(err).Msg("failed to delete idle rate limit buckets")
+			}
+		}
+	}
+}
+
+// KeyFunc return the key of the bucket a request is counted against, false to leave the request unlimited
+type KeyFunc func(r *http.Request) (string, bool)
+
+// ByIp count requests per client IP address. Behind a reverse proxy, this is the address of the proxy, unless chi's
+// RealIP middleware takes it from the forwarding headers.
+func ByIp(r *http.Request) (string, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr, true
+	}
+	return host, true
+}
+
+// ByContext count requests per value of the given context key, e.g. the id of the authenticated user. The middleware
+// has to come after the one setting the value.
+func ByContext(key string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		value := r.Context().Value(key)
+		if value == nil {
+			return "", false
+		}
+		return fmt.Sprint(value), true
+	}
+}
+
+// Limit create a middleware limiting requests to limit per key. Buckets are namespaced by name, so that middlewares
+// with different limits don't share buckets. Limits with a zero burst are disabled.
+//
+// The state of the bucket is reported in the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers of the
+// IETF draft on rate limit headers, and rejected requests get a Retry-After header.
+func (l *Limiter) Limit(name string, limit config.RateLimit, keyFunc KeyFunc) func(http.Handler) http.Handler {
+	if limit.Burst <= 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	l.mu.Lock()
+	l.maxPeriod = max(l.maxPeriod, limit.Period)
+	l.mu.Unlock()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := keyFunc(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := l.store.take(r.Context(), name+":"+key, limit, time.Now())
+			if err != nil {
+				// Failing open: an outage of the limiter should not take the whole API down with it
+				log.Error().Err(err).Msg("rate limiting failed")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, int(limit.Period.Seconds())))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.reset)))
+			if !res.allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.retryAfter), 1)))
+				common.WriteJSON(w, http.StatusTooManyRequests, common.ErrorResponse{Error: tooManyRequests})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -19,6 +19,8 @@ func NewApi(s *Service) *Api {
 type GetUserInfoResponse struct {
 	FirstName string `json:"firstName" validate:"required" example:"John"`
 	LastName  string `json:"lastName" validate:"required" example:"Doe"`
+	// RecoveryCodesRemaining is the number of unused MFA recovery codes, 0 if MFA is not enabled
+	RecoveryCodesRemaining int `json:"recoveryCodesRemaining" validate:"required" example:"10"`
 }
 
 // GetUserInfoBasic fetch the authenticated user's first and last name - basic auth
@@ -29,7 +31,10 @@ type GetUserInfoResponse struct {
 //	@Success	200	{object}	GetUserInfoResponse
 //	@Failure	400	{object}	common.ErrorResponse
 //	@Failure	401	{object}	common.ErrorResponse
+//	@Failure	403	{object}	common.ErrorResponse
+//	@Failure	429	{object}	auth.LockoutResponse	"locked out or rate limit exceeded"
 //	@Failure	500
+//	@Failure	503	{object}	common.ErrorResponse	"too many concurrent password hashes"
 //	@Router		/user/basic [get]
 //	@Security	BasicAuth
 func (api *Api) GetUserInfoBasic(w http.ResponseWriter, r *http.Request) {
@@ -74,7 +79,9 @@ func (api *Api) GetUserInfoToken(w http.ResponseWriter, r *http.Request) {
 //	@Success	200	{object}	GetUserInfoResponse
 //	@Failure	400	{object}	common.ErrorResponse
 //	@Failure	401	{object}	common.ErrorResponse
+//	@Failure	403	{object}	common.ErrorResponse
 //	@Failure	500
+//	@Failure	503	{object}	common.ErrorResponse	"too many concurrent password hashes"
 //	@Router		/user/api-key [get]
 //	@Security	ApiKey
 func (api *Api) GetUserInfoApiKey(w http.ResponseWriter, r *http.Request) {
@@ -97,5 +104,5 @@ func (api *Api) getUserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	common.WriteJSON(w, http.StatusOK, GetUserInfoResponse{userData.FirstName, userData.LastName})
+	common.WriteJSON(w, http.StatusOK, GetUserInfoResponse{userData.FirstName, userData.LastName, userData.RecoveryCodesRemaining})
 }
@@ -16,8 +16,9 @@ func NewService(pool *pgxpool.Pool) *Service {
 }
 
 type userDataRs struct {
-	FirstName string
-	LastName  string
+	FirstName              string
+	LastName               string
+	RecoveryCodesRemaining int
 }
 
 func (s *Service) getUserData(ctx context.Context, id *uuid.UUID) (*userDataRs, error) {
@@ -27,7 +28,8 @@ func (s *Service) getUserData(ctx context.Context, id *uuid.UUID) (*userDataRs,
 		return nil, err
 	}
 	return &userDataRs{
-		FirstName: info.FirstName,
-		LastName:  info.LastName,
+		FirstName:              info.FirstName,
+		LastName:               info.LastName,
+		RecoveryCodesRemaining: int(info.RecoveryCodesRemaining),
 	}, nil
 }